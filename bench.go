@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davecheney/gogo/bench"
+	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
+	"github.com/davecheney/gogo/test"
+)
+
+func init() {
+	registerCommand("bench", BenchCmd)
+}
+
+var (
+	// bench flags
+
+	// the regular expression selecting benchmarks to run.
+	Bench string
+
+	// the number of times to run each benchmark.
+	BenchCount int
+
+	// the revision to record results against.
+	Rev string
+
+	// the stored revision, or range of revisions, to compare against.
+	Compare string
+
+	// the significance level of comparisons.
+	Alpha float64
+)
+
+func addBenchFlags(fs *flag.FlagSet) {
+	addBuildFlags(fs)
+	fs.StringVar(&Bench, "bench", ".", "run only benchmarks matching this regular expression")
+	fs.IntVar(&BenchCount, "count", 5, "run each benchmark this many times")
+	fs.StringVar(&Rev, "rev", "", "record results against this revision, defaults to the output of git describe")
+	fs.StringVar(&Compare, "compare", "", "compare results with this stored revision, or compare two stored revisions old..new")
+	fs.Float64Var(&Alpha, "alpha", 0.05, "the significance level of comparisons")
+}
+
+var BenchCmd = &Command{
+	Run: func(proj *project.Project, args []string) (err error) {
+		if i := strings.Index(Compare, ".."); i >= 0 {
+			// compare two stored runs, nothing is run.
+			before, err := bench.Load(benchFile(proj, Compare[:i]))
+			if err != nil {
+				return err
+			}
+			after, err := bench.Load(benchFile(proj, Compare[i+2:]))
+			if err != nil {
+				return err
+			}
+			return bench.WriteComparison(os.Stdout, bench.Compare(before, after, Alpha))
+		}
+		var before *bench.Run
+		if Compare != "" {
+			if before, err = bench.Load(benchFile(proj, Compare)); err != nil {
+				return err
+			}
+		}
+		rev := Rev
+		if rev == "" {
+			if rev, err = revision(proj); err != nil {
+				return fmt.Errorf("could not determine revision, use -rev: %v", err)
+			}
+		}
+
+		ctx, err := newContext(proj)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if derr := destroyContext(ctx, err); err == nil {
+				err = derr
+			}
+		}()
+		defer cancelOnInterrupt(ctx)()
+		tctx := test.NewContext(ctx)
+		tctx.Bench = Bench
+		tctx.Count = BenchCount
+		tctx.Verbose = log.Verbose
+		// benchmarks are run one at a time so they do not
+		// compete with each other for the CPU.
+		tctx.Parallel = 1
+		pkgs, err := resolvePackages(proj, args)
+		if err != nil {
+			return err
+		}
+
+		run := &bench.Run{
+			Revision: rev,
+			Time:     time.Now(),
+			GOOS:     *goos,
+			GOARCH:   *goarch,
+		}
+		for _, pkg := range pkgs {
+			result := test.Test(tctx, pkg)
+			if err := result.Result(); err != nil {
+				printTestResult(pkg, result, err)
+				return err
+			}
+			os.Stdout.Write(result.Output())
+			results, err := bench.Parse(pkg.ImportPath, bytes.NewReader(result.Output()))
+			if err != nil {
+				return err
+			}
+			run.Results = append(run.Results, results...)
+		}
+		if N {
+			return nil
+		}
+		file := benchFile(proj, rev)
+		if err := run.Save(file); err != nil {
+			return err
+		}
+		log.Infof("saved benchmark results to %s", file)
+		if before == nil {
+			return nil
+		}
+		return bench.WriteComparison(os.Stdout, bench.Compare(before, run, Alpha))
+	},
+	AddFlags: addBenchFlags,
+}
+
+// benchFile returns the file where the benchmark results of rev are stored.
+func benchFile(proj *project.Project, rev string) string {
+	return filepath.Join(proj.Root(), projectdir, "bench", strings.Replace(rev, "/", "_", -1)+".json")
+}
+
+// revision returns the current revision of the project, as reported
+// by git describe.
+func revision(proj *project.Project) (string, error) {
+	cmd := exec.Command("git", "describe", "--always", "--dirty")
+	cmd.Dir = proj.Root()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,99 @@
+// Package gogo/bench provides functions for recording and comparing
+// the results of Go benchmarks.
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is a single line of benchmark output.
+type Result struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+
+	// N is the number of iterations the benchmark ran for.
+	N int `json:"n"`
+
+	// Metrics holds the measurements reported by the benchmark,
+	// keyed by unit, for example "ns/op", "B/op" or "allocs/op".
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// Parse reads the benchmark results of the package pkg from the output
+// of a test binary. Lines which are not benchmark results are ignored.
+func Parse(pkg string, r io.Reader) ([]Result, error) {
+	var results []Result
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if r, ok := parseLine(s.Text()); ok {
+			r.Package = pkg
+			results = append(results, r)
+		}
+	}
+	return results, s.Err()
+}
+
+// parseLine parses a line of the form
+//
+//	BenchmarkName-8   1000   1234 ns/op   16 B/op   1 allocs/op
+func parseLine(line string) (Result, bool) {
+	f := strings.Fields(line)
+	if len(f) < 4 || len(f)%2 != 0 || !strings.HasPrefix(f[0], "Benchmark") {
+		return Result{}, false
+	}
+	n, err := strconv.Atoi(f[1])
+	if err != nil {
+		return Result{}, false
+	}
+	r := Result{Name: f[0], N: n, Metrics: make(map[string]float64)}
+	for i := 2; i < len(f); i += 2 {
+		v, err := strconv.ParseFloat(f[i], 64)
+		if err != nil {
+			return Result{}, false
+		}
+		r.Metrics[f[i+1]] = v
+	}
+	return r, true
+}
+
+// Run is the set of results recorded for one revision of a project.
+type Run struct {
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+	GOOS     string    `json:"goos"`
+	GOARCH   string    `json:"goarch"`
+	Results  []Result  `json:"results"`
+}
+
+// Load reads the Run stored in the named file.
+func Load(path string) (*Run, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Run
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Save writes r to the named file, creating its directory if required.
+func (r *Run) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const benchOutput = `goos: linux
+goarch: amd64
+BenchmarkA-8   	 1000000	      1234 ns/op	      16 B/op	       1 allocs/op
+BenchmarkB-8   	     500	   2345678 ns/op	  42.50 MB/s
+--- BENCH: BenchmarkC
+    c_test.go:12: some log output
+BenchmarkC
+PASS
+ok  	a	3.210s
+`
+
+func TestParse(t *testing.T) {
+	got, err := Parse("a", strings.NewReader(benchOutput))
+	if err != nil {
+		t.Fatalf("Parse(): %v", err)
+	}
+	want := []Result{
+		{Package: "a", Name: "BenchmarkA-8", N: 1000000, Metrics: map[string]float64{"ns/op": 1234, "B/op": 16, "allocs/op": 1}},
+		{Package: "a", Name: "BenchmarkB-8", N: 500, Metrics: map[string]float64{"ns/op": 2345678, "MB/s": 42.5}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse(): expected %+v, got %+v", want, got)
+	}
+}
+
+var mannWhitneyUTests = []struct {
+	x, y []float64
+	want float64
+}{
+	// completely separated samples of five, 2/C(10,5).
+	{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+	{[]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+	// identical samples.
+	{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+	// interleaved samples.
+	{[]float64{1, 3, 5, 7}, []float64{2, 4, 6, 8}, 0.6857142857142857},
+	{nil, []float64{1}, 1},
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tt := range mannWhitneyUTests {
+		if got := MannWhitneyU(tt.x, tt.y); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("MannWhitneyU(%v, %v): expected %v, got %v", tt.x, tt.y, tt.want, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	run := func(ns ...float64) *Run {
+		var r Run
+		for _, v := range ns {
+			r.Results = append(r.Results, Result{Package: "a", Name: "BenchmarkA", N: 1, Metrics: map[string]float64{"ns/op": v, "B/op": 16}})
+		}
+		return &r
+	}
+	deltas := Compare(run(100, 101, 99, 100, 102), run(120, 121, 119, 122, 120), 0.05)
+	if len(deltas) != 2 {
+		t.Fatalf("Compare(): expected 2 deltas, got %d", len(deltas))
+	}
+	if d := deltas[0]; d.Unit != "ns/op" || !d.Significant || !d.Regression() {
+		t.Errorf("Compare(): expected ns/op regression, got %+v", d)
+	}
+	if d := deltas[1]; d.Unit != "B/op" || d.Significant || d.Regression() {
+		t.Errorf("Compare(): expected no change in B/op, got %+v", d)
+	}
+	var buf bytes.Buffer
+	if err := WriteComparison(&buf, deltas); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "REGRESSION") {
+		t.Errorf("WriteComparison(): regression not marked:\n%s", buf.String())
+	}
+}
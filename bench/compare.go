@@ -0,0 +1,146 @@
+package bench
+
+// comparison of runs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Delta is the change in one metric of a benchmark between two Runs.
+type Delta struct {
+	Package, Name, Unit string
+
+	// Old and New are the samples recorded by each Run.
+	Old, New []float64
+
+	// P is the p-value of the Mann-Whitney U test of Old and New.
+	P float64
+
+	// Significant is set if P is below the significance level
+	// passed to Compare.
+	Significant bool
+}
+
+// Change returns the relative change of the mean from Old to New,
+// as a percentage.
+func (d *Delta) Change() float64 {
+	old := mean(d.Old)
+	if old == 0 {
+		return 0
+	}
+	return (mean(d.New) - old) / old * 100
+}
+
+// Regression reports whether the metric got significantly worse.
+// Rates, such as MB/s, are better when higher; all other metrics
+// are better when lower.
+func (d *Delta) Regression() bool {
+	if !d.Significant {
+		return false
+	}
+	if strings.HasSuffix(d.Unit, "/s") {
+		return d.Change() < 0
+	}
+	return d.Change() > 0
+}
+
+type key struct {
+	pkg, name, unit string
+}
+
+// samples groups the metrics of results by package, benchmark and unit.
+func samples(results []Result) map[key][]float64 {
+	m := make(map[key][]float64)
+	for _, r := range results {
+		for unit, v := range r.Metrics {
+			k := key{r.Package, r.Name, unit}
+			m[k] = append(m[k], v)
+		}
+	}
+	return m
+}
+
+// Compare returns the Deltas of each metric recorded by both before
+// and after. A change is significant if its p-value is below alpha.
+func Compare(before, after *Run, alpha float64) []*Delta {
+	o, n := samples(before.Results), samples(after.Results)
+	var deltas []*Delta
+	for k, x := range o {
+		y, ok := n[k]
+		if !ok {
+			continue
+		}
+		p := MannWhitneyU(x, y)
+		deltas = append(deltas, &Delta{
+			Package:     k.pkg,
+			Name:        k.name,
+			Unit:        k.unit,
+			Old:         x,
+			New:         y,
+			P:           p,
+			Significant: p < alpha,
+		})
+	}
+	sort.Sort(byBenchmark(deltas))
+	return deltas
+}
+
+// unitOrder orders the common units first, and in the order
+// the testing package prints them.
+var unitOrder = map[string]int{"ns/op": 1, "MB/s": 2, "B/op": 3, "allocs/op": 4}
+
+type byBenchmark []*Delta
+
+func (b byBenchmark) Len() int      { return len(b) }
+func (b byBenchmark) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byBenchmark) Less(i, j int) bool {
+	if b[i].Package != b[j].Package {
+		return b[i].Package < b[j].Package
+	}
+	if b[i].Name != b[j].Name {
+		return b[i].Name < b[j].Name
+	}
+	ui, uj := unitOrder[b[i].Unit], unitOrder[b[j].Unit]
+	if ui == 0 {
+		ui = len(unitOrder) + 1
+	}
+	if uj == 0 {
+		uj = len(unitOrder) + 1
+	}
+	if ui != uj {
+		return ui < uj
+	}
+	return b[i].Unit < b[j].Unit
+}
+
+// WriteComparison writes a table of deltas to w. Changes which are
+// not significant are shown as ~, regressions are marked.
+func WriteComparison(w io.Writer, deltas []*Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "package\tbenchmark\tunit\told\tnew\tdelta\n")
+	for _, d := range deltas {
+		change := "~"
+		if d.Significant {
+			change = fmt.Sprintf("%+.2f%%", d.Change())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s (p=%.3f n=%d+%d)", d.Package, d.Name, d.Unit, format(mean(d.Old)), format(mean(d.New)), change, d.P, len(d.Old), len(d.New))
+		if d.Regression() {
+			fmt.Fprintf(tw, "  REGRESSION")
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	return tw.Flush()
+}
+
+// format formats v with at least three significant figures.
+func format(v float64) string {
+	if v >= 100 || v <= -100 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
@@ -0,0 +1,132 @@
+package bench
+
+// statistics
+
+import (
+	"math"
+	"sort"
+)
+
+// mean returns the arithmetic mean of x.
+func mean(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+// MannWhitneyU returns the two sided p-value of the Mann-Whitney U test
+// of the hypothesis that the samples x and y are drawn from the same
+// distribution. The exact distribution of U is used for small samples
+// without ties, otherwise the normal approximation is used.
+func MannWhitneyU(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// rank the combined samples, giving tied values their mean rank.
+	all := make(byValue, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Sort(all)
+	var r1, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].x {
+				r1 += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	u := r1 - float64(n1*(n1+1))/2
+
+	if ties == 0 && n1 <= 50 && n2 <= 50 {
+		return exactU(n1, n2, u)
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		return 1
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// obs is an observation from one of two samples.
+type obs struct {
+	v float64
+	x bool // from the first sample
+}
+
+type byValue []obs
+
+func (b byValue) Len() int           { return len(b) }
+func (b byValue) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byValue) Less(i, j int) bool { return b[i].v < b[j].v }
+
+// exactU returns the two sided p-value of u using the exact
+// distribution of the U statistic for samples of size n1 and n2.
+func exactU(n1, n2 int, u float64) float64 {
+	// counts[j][k] is the number of arrangements of i values from the
+	// first sample and j from the second for which U is k.
+	max := n1 * n2
+	counts := make([][]float64, n2+1)
+	for j := range counts {
+		counts[j] = make([]float64, max+1)
+		counts[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		next := make([][]float64, n2+1)
+		next[0] = make([]float64, max+1)
+		next[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			next[j] = make([]float64, max+1)
+			for k := 0; k <= i*j; k++ {
+				// the largest value is either from the first sample,
+				// which then exceeds all j values of the second, or
+				// from the second sample.
+				if k >= j {
+					next[j][k] += counts[j][k-j]
+				}
+				next[j][k] += next[j-1][k]
+			}
+		}
+		counts = next
+	}
+	var total, lower, upper float64
+	for k, c := range counts[n2] {
+		total += c
+		if float64(k) <= u {
+			lower += c
+		}
+		if float64(k) >= u {
+			upper += c
+		}
+	}
+	p := 2 * math.Min(lower, upper) / total
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
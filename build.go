@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	gobuild "go/build"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"time"
 
@@ -26,23 +28,132 @@ var (
 	// should we perform a release build +release tag ?
 	// defaults to false, +debug.
 	R bool
+
+	// should we print the commands, but not run them ?
+	N bool
+
+	// should we print the commands as they are run ?
+	X bool
+
+	// should we print the location of, and keep, the work directory ?
+	Work bool
+
+	// should we keep going after the first failure ?
+	K bool
+
+	// should we build with the race detector, or the memory
+	// or address sanitizers ?
+	Race, MSan, ASan bool
+
+	// should packages which violate the import rules fail to resolve ?
+	CheckImports bool
 )
 
 func addBuildFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&A, "a", false, "build all packages in this project")
 	fs.BoolVar(&R, "r", false, "perform a release build")
+	fs.BoolVar(&N, "n", false, "print the commands but do not run them")
+	fs.BoolVar(&X, "x", false, "print the commands as they are run")
+	fs.BoolVar(&Work, "work", false, "print the name of the work directory and do not delete it")
+	fs.BoolVar(&K, "k", false, "keep going after the first failure")
+	fs.BoolVar(&Race, "race", false, "enable the race detector")
+	fs.BoolVar(&MSan, "msan", false, "enable interoperation with the memory sanitizer")
+	fs.BoolVar(&ASan, "asan", false, "enable interoperation with the address sanitizer")
+	fs.BoolVar(&CheckImports, "checkimports", false, "fail packages whose imports violate the rules in .gogo/rules")
+}
+
+// instrumentMode returns the build.Context instrumentation mode
+// selected by the -race, -msan and -asan flags.
+func instrumentMode() (string, error) {
+	var modes []string
+	if Race {
+		modes = append(modes, build.Race)
+	}
+	if MSan {
+		modes = append(modes, build.MSan)
+	}
+	if ASan {
+		modes = append(modes, build.ASan)
+	}
+	switch len(modes) {
+	case 0:
+		return "", nil
+	case 1:
+		return modes[0], nil
+	default:
+		return "", fmt.Errorf("only one of -race, -msan and -asan may be set")
+	}
+}
+
+// newContext returns a build.Context for proj configured
+// from the command line flags.
+func newContext(proj *project.Project) (*build.Context, error) {
+	mode, err := instrumentMode()
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := build.NewContext(proj, *toolchain, *goroot, *goos, *goarch)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.SetInstrument(mode); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+	ctx.DryRun = N
+	ctx.Trace = X
+	ctx.KeepWorkdir = Work
+	ctx.Cache = filepath.Join(proj.Root(), projectdir, "cache", "pkg")
+	if Work && !N && !X {
+		// with -n or -x the script printed to stderr starts with WORK=
+		fmt.Fprintf(os.Stderr, "WORK=%s\n", ctx.Workdir())
+	}
+	return ctx, nil
+}
+
+// cancelOnInterrupt cancels ctx if the process receives an interrupt.
+// The returned function stops watching for interrupts.
+func cancelOnInterrupt(ctx *build.Context) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		if _, ok := <-c; ok {
+			log.Errorf("interrupted, cancelling build")
+			ctx.Cancel()
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// destroyContext removes the work directory of ctx. If the command
+// failed, and -v is set, the work directory is kept for inspection.
+func destroyContext(ctx *build.Context, err error) error {
+	if err != nil && log.Verbose && !ctx.KeepWorkdir {
+		log.Infof("kept workdir at %s", ctx.Workdir())
+		return nil
+	}
+	return ctx.Destroy()
 }
 
 var BuildCmd = &Command{
-	Run: func(proj *project.Project, args []string) error {
+	Run: func(proj *project.Project, args []string) (err error) {
 		t0 := time.Now()
 		defer func() {
 			log.Infof("build duration: %v", time.Since(t0))
 		}()
-		ctx, err := build.NewContext(proj, *toolchain, *goroot, *goos, *goarch)
+		ctx, err := newContext(proj)
 		if err != nil {
 			return err
 		}
+		defer func() {
+			if derr := destroyContext(ctx, err); err == nil {
+				err = derr
+			}
+		}()
+		defer cancelOnInterrupt(ctx)()
 		defer func() {
 			log.Debugf("build statistics: %v", ctx.Statistics.String())
 		}()
@@ -57,12 +168,12 @@ var BuildCmd = &Command{
 		for _, arg := range args {
 			if arg == "." {
 				var err error
-				arg, err = filepath.Rel(proj.SrcDirs[0].SrcDir(), mustGetwd())
+				arg, err = proj.SrcDirs[0].ImportPath(mustGetwd())
 				if err != nil {
 					return err
 				}
 			}
-			pkg, err := ctx.ResolvePackage("linux", "amd64", arg).Result()
+			pkg, err := ctx.ResolvePackage(*goos, *goarch, arg).Result()
 			if err != nil {
 				if _, ok := err.(*gobuild.NoGoError); ok {
 					log.Debugf("skipping %q", arg)
@@ -79,12 +190,21 @@ var BuildCmd = &Command{
 				results <- build.Build(ctx, pkg)
 			}
 		}()
+		var failed int
 		for result := range results {
 			if err := result.Result(); err != nil {
-				return err
+				if !K {
+					ctx.Cancel()
+					return err
+				}
+				log.Errorf("%v", err)
+				failed++
 			}
 		}
-		return ctx.Destroy()
+		if failed > 0 {
+			return fmt.Errorf("%d of %d packages failed to build", failed, len(pkgs))
+		}
+		return nil
 	},
 	AddFlags: addBuildFlags,
 }
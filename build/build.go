@@ -2,13 +2,16 @@
 package build
 
 import (
+	"bytes"
+	"fmt"
 	"go/build"
+	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
 )
 
 // A Future represents the result of a build operation.
@@ -41,8 +44,7 @@ func Build(ctx *Context, pkg *build.Package) Future {
 func buildPackage(ctx *Context, pkg *build.Package) Future {
 	var deps []Future
 	for _, dep := range pkg.Imports {
-		// TODO(dfc) use project.Spec
-		pkg, err := ctx.ResolvePackage(runtime.GOOS, runtime.GOARCH, dep).Result()
+		pkg, err := ctx.ResolvePackage(ctx.goos, ctx.goarch, dep).Result()
 		if err != nil {
 			return &errFuture{err}
 		}
@@ -56,8 +58,7 @@ func buildPackage(ctx *Context, pkg *build.Package) Future {
 func buildCommand(ctx *Context, pkg *build.Package) Future {
 	var deps []Future
 	for _, dep := range pkg.Imports {
-		// TODO(dfc) use project.Spec
-		pkg, err := ctx.ResolvePackage(runtime.GOOS, runtime.GOARCH, dep).Result()
+		pkg, err := ctx.ResolvePackage(ctx.goos, ctx.goarch, dep).Result()
 		if err != nil {
 			return errFuture{err}
 		}
@@ -69,11 +70,24 @@ func buildCommand(ctx *Context, pkg *build.Package) Future {
 }
 
 // Compile returns a Future representing all the steps required to build a go package.
+// If the Context has a Cache, cgo packages are only rebuilt if they have changed.
 func Compile(ctx *Context, pkg *build.Package, deps []Future) PkgFuture {
+	if usesCgo(ctx, pkg) && ctx.Cache != "" && !ctx.DryRun {
+		return cachedCompile(ctx, pkg, deps)
+	}
+	return compile(ctx, pkg, deps)
+}
+
+// usesCgo reports whether pkg is built with cgo.
+func usesCgo(ctx *Context, pkg *build.Package) bool {
+	return ctx.cgoEnabled && (len(pkg.CgoFiles) > 0 || len(pkg.SwigFiles) > 0 || len(pkg.SwigCXXFiles) > 0)
+}
+
+func compile(ctx *Context, pkg *build.Package, deps []Future) PkgFuture {
 	var gofiles []string
 	gofiles = append(gofiles, pkg.GoFiles...)
 	var objs []ObjFuture
-	if len(pkg.CgoFiles) > 0 {
+	if usesCgo(ctx, pkg) {
 		cgo, cgofiles := cgo(ctx, pkg, deps)
 		deps = append(deps, cgo[0])
 		objs = append(objs, cgo...)
@@ -83,9 +97,19 @@ func Compile(ctx *Context, pkg *build.Package, deps []Future) PkgFuture {
 	for _, sfile := range pkg.SFiles {
 		objs = append(objs, Asm(ctx, pkg, sfile))
 	}
+	for _, sysofile := range pkg.SysoFiles {
+		objs = append(objs, objFile(filepath.Join(pkg.Dir, sysofile)))
+	}
 	return Pack(ctx, pkg, objs)
 }
 
+// objFile is an ObjFuture for an object file which already
+// exists, like a .syso file.
+type objFile string
+
+func (objFile) Result() error     { return nil }
+func (o objFile) Objfile() string { return string(o) }
+
 // ObjFuture represents a Future that produces an Object file.
 type ObjFuture interface {
 	Future
@@ -149,6 +173,11 @@ func Ld(ctx *Context, pkg *build.Package, afile PkgFuture) Future {
 	return t
 }
 
+// Binfile returns the path of the command that Build links for pkg.
+func Binfile(ctx *Context, pkg *build.Package) string {
+	return filepath.Join(ctx.Bindir(), filepath.Base(pkg.ImportPath))
+}
+
 // objdir returns the destination for object files compiled for this Package.
 func objdir(ctx *Context, pkg *build.Package) string {
 	return filepath.Join(ctx.Workdir(), filepath.FromSlash(pkg.ImportPath), "_obj")
@@ -157,7 +186,7 @@ func objdir(ctx *Context, pkg *build.Package) string {
 // Toolchain represents a standardised set of command line tools
 // used to build and test Go programs.
 type Toolchain interface {
-	Gc(importpath, srcdir, outfile string, files []string) error
+	Gc(importpath, srcdir, outfile, embedcfg string, importmap map[string]string, files []string) error
 	Asm(srcdir, ofile, sfile string) error
 	Pack(string, ...string) error
 	Ld(string, string) error
@@ -165,42 +194,129 @@ type Toolchain interface {
 
 	Cgo(string, []string) error
 	Gcc(string, []string) error
+	Cxx(string, []string) error
+	Fortran(string, []string) error
+	Swig(string, []string) error
 	Libgcc() (string, error)
 
 	name() string
 }
 
 type toolchain struct {
-	cgo string
-	gcc string
+	cgo  string
+	gcc  string
+	cxx  string
+	fc   string
+	swig string
 	*Context
 }
 
 func (t *toolchain) Cgo(cwd string, args []string) error {
-	return run(cwd, t.cgo, args...)
+	return t.run(cwd, t.env(), t.cgo, args...)
 }
 
 func (t *toolchain) Gcc(cwd string, args []string) error {
-	return run(cwd, t.gcc, args...)
+	return t.runCompiler(cwd, t.gcc, args)
+}
+
+func (t *toolchain) Cxx(cwd string, args []string) error {
+	return t.runCompiler(cwd, t.cxx, args)
+}
+
+func (t *toolchain) Fortran(cwd string, args []string) error {
+	return t.runCompiler(cwd, t.fc, args)
+}
+
+// runCompiler runs the C, C++ or Fortran compiler cmdline, which may
+// include arguments, like CC="ccache gcc", with the sanitizer flags
+// and args following any arguments of its own.
+func (t *toolchain) runCompiler(cwd, cmdline string, args []string) error {
+	command, extra, err := splitCommand(cmdline)
+	if err != nil {
+		return &Error{Err: err}
+	}
+	args = append(append(extra, t.sanitizeFlags()...), args...)
+	return t.run(cwd, nil, command, args...)
+}
+
+// splitCommand splits cmdline, a command optionally followed by
+// arguments, into the command and its arguments.
+func splitCommand(cmdline string) (string, []string, error) {
+	words, err := project.SplitQuoted(cmdline)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid command %q: %v", cmdline, err)
+	}
+	if len(words) == 0 {
+		return "", nil, fmt.Errorf("invalid command %q", cmdline)
+	}
+	return words[0], words[1:], nil
+}
+
+func (t *toolchain) Swig(cwd string, args []string) error {
+	return t.run(cwd, nil, t.swig, args...)
 }
 
 func (t *toolchain) Libgcc() (string, error) {
-	libgcc, err := runOut(".", t.gcc, "-print-libgcc-file-name")
+	command, extra, err := splitCommand(t.gcc)
+	if err != nil {
+		return "", err
+	}
+	libgcc, err := t.runOut(".", nil, command, append(extra, "-print-libgcc-file-name")...)
 	return strings.Trim(string(libgcc), "\r\n"), err
 }
 
-func run(dir, command string, args ...string) error {
-	_, err := runOut(dir, command, args...)
-	return err
+// env returns the environment variables which describe the target
+// of this toolchain to tools like cgo.
+func (t *toolchain) env() []string {
+	return []string{"GOROOT=" + t.goroot, "GOOS=" + t.goos, "GOARCH=" + t.goarch, "CC=" + t.gcc}
 }
 
-func runOut(dir, command string, args ...string) ([]byte, error) {
+// run executes command in dir with the additional environment
+// variables env. If the Context is in DryRun mode the command is
+// only printed. If the command fails an *Error is returned.
+func (c *Context) run(dir string, env []string, command string, args ...string) error {
+	var output bytes.Buffer
+	cmd := newCmd(dir, env, command, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := c.Run(cmd)
+	log.Debugf("cd %s; %s %s", dir, command, strings.Join(args, " "))
+	if err == nil || err == ErrCancelled {
+		return err
+	}
+	diags, rest := parseDiagnostics(dir, c.root, output.Bytes())
+	return &Error{
+		Action:      filepath.Base(command),
+		Diagnostics: diags,
+		Output:      rest,
+		Err:         err,
+	}
+}
+
+// runOut executes command in dir and returns its combined output.
+// runOut is used to query tools for information, so it always
+// executes, even if the Context is in DryRun mode.
+func (c *Context) runOut(dir string, env []string, command string, args ...string) ([]byte, error) {
+	cmd := newCmd(dir, env, command, args...)
+	if c.Trace {
+		c.printcmd(cmd)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := c.execute(cmd)
+	log.Debugf("cd %s; %s %s", dir, command, strings.Join(args, " "))
+	if err != nil && err != ErrCancelled {
+		log.Errorf("%s", output.Bytes())
+	}
+	return output.Bytes(), err
+}
+
+func newCmd(dir string, env []string, command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
 	cmd.Dir = dir
-	output, err := cmd.CombinedOutput()
-	log.Debugf("cd %s; %s %s", dir, command, strings.Join(args, " "))
-	if err != nil {
-		log.Errorf("%s", output)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
-	return output, err
+	return cmd
 }
@@ -1,6 +1,7 @@
 package build
 
 import (
+	"os/exec"
 	"testing"
 
 	"github.com/davecheney/gogo/project"
@@ -15,3 +16,41 @@ func newProject(t *testing.T) *project.Project {
 	}
 	return p
 }
+
+var buildTests = []struct {
+	pkg  string
+	want string // the output of the command
+}{
+	{"helloworld", "Hello, 世界\n"},
+	{"hellocgo", "hello, world\n"}, // imports stdio, which uses cgo
+}
+
+// TestBuild builds and runs commands with the installed toolchain.
+func TestBuild(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	for _, tt := range buildTests {
+		ctx, err := NewDefaultContext(newProject(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), tt.pkg).Result()
+		if err != nil {
+			t.Fatalf("ResolvePackage(%q): %v", tt.pkg, err)
+		}
+		if err := Build(ctx, pkg).Result(); err != nil {
+			t.Errorf("Build(%q): %v", tt.pkg, err)
+			continue
+		}
+		out, err := exec.Command(Binfile(ctx, pkg)).CombinedOutput()
+		if err != nil {
+			t.Errorf("%s: %v: %s", tt.pkg, err, out)
+			continue
+		}
+		if string(out) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.pkg, tt.want, out)
+		}
+	}
+}
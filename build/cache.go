@@ -0,0 +1,348 @@
+package build
+
+// cgo package caching
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/build"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
+)
+
+// cachedCompile returns a PkgFuture representing the result of
+// compiling the cgo package pkg, reusing the archive from a previous
+// build if neither pkg, its dependencies, nor any file the C compiler
+// read while building it, have changed.
+func cachedCompile(ctx *Context, pkg *build.Package, deps []Future) PkgFuture {
+	t := &cacheTarget{
+		target: newTarget(ctx, pkg),
+		deps:   deps,
+	}
+	go t.execute()
+	return t
+}
+
+// cacheTarget implements a PkgFuture that represents a cgo package
+// which may be satisfied from the package cache.
+type cacheTarget struct {
+	target
+	deps []Future
+}
+
+func (t *cacheTarget) execute() {
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
+	}
+	t.err <- t.build()
+}
+
+func (t *cacheTarget) pkgfile() string {
+	return filepath.Join(t.Workdir(), filepath.FromSlash(t.ImportPath+".a"))
+}
+
+func (t *cacheTarget) build() error {
+	key, err := t.cacheKey()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(t.Cache, key)
+	if t.cached(dir) {
+		log.Infof("cached %q", t.ImportPath)
+		if err := t.Mkdir(filepath.Dir(t.pkgfile())); err != nil {
+			return err
+		}
+		return t.Copy(t.pkgfile(), filepath.Join(dir, "pkg.a"))
+	}
+	pack := compile(t.Context, t.Package, t.deps)
+	if err := pack.Result(); err != nil {
+		return err
+	}
+	inputs, err := readDepfiles(objdir(t.Context, t.Package), t.Srcdir(), t.Workdir())
+	if err != nil {
+		return err
+	}
+	if err := writeCacheEntry(dir, pack.pkgfile(), inputs); err != nil {
+		// the package was built, failing to cache it is not fatal.
+		log.Errorf("could not cache %q: %v", t.ImportPath, err)
+	}
+	return nil
+}
+
+// cached reports whether dir holds an archive whose recorded inputs
+// are unchanged.
+func (t *cacheTarget) cached(dir string) bool {
+	t0 := time.Now()
+	defer func() { t.Record("cache", time.Since(t0)) }()
+	f, err := os.Open(filepath.Join(dir, "manifest"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	inputs, err := readManifest(f)
+	if err != nil {
+		log.Debugf("cache %q: %v", t.ImportPath, err)
+		return false
+	}
+	for path, sum := range inputs {
+		h := sha256.New()
+		if err := hashFile(h, path); err != nil || fmt.Sprintf("%x", h.Sum(nil)) != sum {
+			log.Debugf("cache %q: %s has changed", t.ImportPath, path)
+			return false
+		}
+	}
+	_, err = os.Stat(filepath.Join(dir, "pkg.a"))
+	return err == nil
+}
+
+// cacheKey returns the key under which the archive of the package is
+// stored, see PackageKey. The headers the package includes are
+// recorded separately in the manifest of the cache entry, as they are
+// only known after the package has been built.
+func (t *cacheTarget) cacheKey() (string, error) {
+	return PackageKey(t.Context, t.Package)
+}
+
+// keyCache memoises the keys returned by PackageKey.
+type keyCache struct {
+	sync.Mutex
+	m map[*build.Package]string
+}
+
+// PackageKey returns a key identifying the archive of pkg built with
+// ctx. The key covers the toolchain and its configuration, the source
+// and embedded files of pkg, and the keys of the packages it imports.
+// Unlike the archives themselves, which record the work directory they
+// were built in, the key is the same for every build of unchanged
+// sources.
+func PackageKey(ctx *Context, pkg *build.Package) (string, error) {
+	ctx.keys.Lock()
+	key, ok := ctx.keys.m[pkg]
+	ctx.keys.Unlock()
+	if ok {
+		return key, nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "toolchain %s %s/%s %q\n", ctx.Toolchain.name(), ctx.goos, ctx.goarch, ctx.instrument)
+	fmt.Fprintf(h, "goroot %q\n", ctx.goroot)
+	if version, err := ioutil.ReadFile(filepath.Join(ctx.goroot, "VERSION")); err == nil {
+		fmt.Fprintf(h, "version %q\n", version)
+	}
+	fmt.Fprintf(h, "cc %q %q %q\n", ctx.CC, ctx.CXX, ctx.FC)
+	fmt.Fprintf(h, "flags %q %q %q %q %q\n", ctx.CgoCPPFLAGS, ctx.CgoCFLAGS, ctx.CgoCXXFLAGS, ctx.CgoFFLAGS, ctx.CgoLDFLAGS)
+	fmt.Fprintf(h, "package %q %q\n", pkg.ImportPath, pkg.Name)
+	for _, files := range [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.MFiles, pkg.FFiles,
+		pkg.SFiles, pkg.SysoFiles, pkg.SwigFiles, pkg.SwigCXXFiles,
+	} {
+		for _, file := range files {
+			path := file
+			if filepath.IsAbs(file) {
+				// a generated file, like the coverage copies of
+				// gogo test -cover, named by its place in Workdir.
+				file = filepath.Base(file)
+			} else {
+				path = filepath.Join(pkg.Dir, file)
+			}
+			fmt.Fprintf(h, "file %q\n", file)
+			if err := hashFile(h, path); err != nil {
+				return "", err
+			}
+		}
+	}
+	embeds, _, err := project.ResolveEmbed(pkg.Dir, pkg.EmbedPatterns)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range embeds {
+		fmt.Fprintf(h, "embed %q\n", file)
+		if err := hashFile(h, filepath.Join(pkg.Dir, filepath.FromSlash(file))); err != nil {
+			return "", err
+		}
+	}
+	imports := append([]string(nil), pkg.Imports...)
+	sort.Strings(imports)
+	for _, path := range imports {
+		dep, err := ctx.ResolvePackage(ctx.goos, ctx.goarch, path).Result()
+		if err != nil {
+			return "", err
+		}
+		key, err := PackageKey(ctx, dep)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "import %q %s\n", path, key)
+	}
+	key = fmt.Sprintf("%x", h.Sum(nil))
+	ctx.keys.Lock()
+	if ctx.keys.m == nil {
+		ctx.keys.m = make(map[*build.Package]string)
+	}
+	ctx.keys.m[pkg] = key
+	ctx.keys.Unlock()
+	return key, nil
+}
+
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// readDepfiles returns the files named by the dependency (.d) files
+// gcc wrote to objdir. Relative paths, such as those of headers found
+// through a relative #cgo CFLAGS: -I directory, are relative to srcdir,
+// where gcc is run. Files below workdir, which are generated for each
+// build, are omitted.
+func readDepfiles(objdir, srcdir, workdir string) ([]string, error) {
+	depfiles, err := filepath.Glob(filepath.Join(objdir, "*.d"))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var inputs []string
+	for _, depfile := range depfiles {
+		data, err := ioutil.ReadFile(depfile)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range parseDepfile(data) {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(srcdir, path)
+			}
+			path = filepath.Clean(path)
+			if seen[path] || strings.HasPrefix(path, workdir+string(filepath.Separator)) {
+				continue
+			}
+			seen[path] = true
+			inputs = append(inputs, path)
+		}
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+// parseDepfile returns the prerequisites listed in the make rules of
+// a dependency file written by gcc -MD.
+func parseDepfile(data []byte) []string {
+	var deps []string
+	var word []byte
+	target := true
+	flush := func() {
+		if len(word) > 0 && !target {
+			deps = append(deps, string(word))
+		}
+		word = word[:0]
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data) && data[i+1] == '\n':
+			// line continuation
+			flush()
+			i++
+		case c == '\\' && i+1 < len(data) && data[i+1] == ' ':
+			word = append(word, ' ')
+			i++
+		case c == '$' && i+1 < len(data) && data[i+1] == '$':
+			word = append(word, '$')
+			i++
+		case c == ':' && target && (i+1 == len(data) || data[i+1] == ' ' || data[i+1] == '\n'):
+			word = word[:0]
+			target = false
+		case c == '\n':
+			flush()
+			target = true
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		default:
+			word = append(word, c)
+		}
+	}
+	flush()
+	return deps
+}
+
+// writeCacheEntry stores afile, and a manifest of the hashes of
+// inputs, in dir.
+func writeCacheEntry(dir, afile string, inputs []string) error {
+	var manifest bytes.Buffer
+	for _, path := range inputs {
+		h := sha256.New()
+		if err := hashFile(h, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "%x %s\n", h.Sum(nil), path)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), "tmp")
+	if err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(tmp, "pkg.a"), afile); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "manifest"), manifest.Bytes(), 0666); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// readManifest parses a manifest written by writeCacheEntry into a
+// map of paths to their hashes.
+func readManifest(r io.Reader) (map[string]string, error) {
+	inputs := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		i := strings.Index(line, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid manifest line: %q", line)
+		}
+		inputs[line[i+1:]] = line[:i]
+	}
+	return inputs, s.Err()
+}
+
+func copyFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,232 @@
+package build
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/davecheney/gogo/project"
+)
+
+var parseDepfileTests = []struct {
+	data string
+	want []string
+}{
+	{"", nil},
+	{"a.o: a.c\n", []string{"a.c"}},
+	{"a.o: a.c /usr/include/stdio.h \\\n /usr/include/features.h\n", []string{"a.c", "/usr/include/stdio.h", "/usr/include/features.h"}},
+	{"a.o: /opt/my\\ lib/x.h\n", []string{"/opt/my lib/x.h"}},
+	{"a.o: a.c\nb.o: b.c b.h\n", []string{"a.c", "b.c", "b.h"}},
+	{"C:/obj/a.o: a.c\n", []string{"a.c"}},
+}
+
+func TestParseDepfile(t *testing.T) {
+	for _, tt := range parseDepfileTests {
+		got := parseDepfile([]byte(tt.data))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDepfile(%q): expected %q, got %q", tt.data, tt.want, got)
+		}
+	}
+}
+
+func TestCacheEntry(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	afile := filepath.Join(tmp, "a.a")
+	header := filepath.Join(tmp, "a.h")
+	for _, file := range []string{afile, header} {
+		if err := ioutil.WriteFile(file, []byte(file), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := filepath.Join(tmp, "cache", "key")
+	if err := writeCacheEntry(dir, afile, []string{header}); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, "manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := readManifest(strings.NewReader(string(manifest)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := inputs[header]; !ok || len(inputs) != 1 {
+		t.Errorf("readManifest: expected %q, got %q", header, inputs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pkg.a")); err != nil {
+		t.Errorf("writeCacheEntry: %v", err)
+	}
+}
+
+func TestPackageKeyEmbed(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for name, data := range map[string]string{
+		"a.go":     "package a\n",
+		"data.txt": "hello\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg := &build.Package{
+		Name:          "a",
+		ImportPath:    "a",
+		Dir:           tmp,
+		GoFiles:       []string{"a.go"},
+		EmbedPatterns: []string{"data.txt"},
+	}
+	before := packageKey(t, newProject(t), pkg)
+	if again := packageKey(t, newProject(t), pkg); again != before {
+		t.Errorf("PackageKey: expected %s in a new work directory, got %s", before, again)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "data.txt"), []byte("goodbye\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if after := packageKey(t, newProject(t), pkg); after == before {
+		t.Errorf("PackageKey: expected the key to change with the embedded file, got %s twice", before)
+	}
+}
+
+func TestPackageKeyImports(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for file, data := range map[string]string{
+		"src/a/a.go": "package a\n\nimport _ \"b\"\n",
+		"src/b/b.go": "package b\n",
+	} {
+		path := filepath.Join(tmp, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := func() string {
+		p, err := project.NewProject(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := p.ResolvePackage(runtime.GOOS, runtime.GOARCH, "a").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packageKey(t, p, pkg)
+	}
+	before := key()
+	if again := key(); again != before {
+		t.Errorf("PackageKey: expected %s in a new work directory, got %s", before, again)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "src", "b", "b.go"), []byte("package b\n\nconst B = 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if after := key(); after == before {
+		t.Errorf("PackageKey: expected the key to change with the imported package, got %s twice", before)
+	}
+}
+
+// packageKey returns the key of pkg computed with a new Context.
+func packageKey(t *testing.T, p *project.Project, pkg *build.Package) string {
+	ctx, err := NewDefaultContext(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	key, err := PackageKey(ctx, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var cacheHeaderTests = []struct {
+	header string // the location of b.h, relative to the temporary directory
+	cflags []string
+}{
+	{"a/b.h", nil}, // in the package directory
+	{"a/include/b.h", []string{"-I", "include"}},    // relative to the package directory
+	{"include/b.h", []string{"-I", "$TMP/include"}}, // outside the package directory
+}
+
+func TestCacheHeaders(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	for _, tt := range cacheHeaderTests {
+		tmp, err := ioutil.TempDir("", "gogo-cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		for file, data := range map[string]string{
+			"a/a.c":   "#include \"b.h\"\nint f(void) { return B; }\n",
+			tt.header: "#define B 1\n",
+		} {
+			path := filepath.Join(tmp, filepath.FromSlash(file))
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ctx, err := NewDefaultContext(newProject(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		pkg := &build.Package{
+			Name:       "a",
+			ImportPath: "a",
+			Dir:        filepath.Join(tmp, "a"),
+			CFiles:     []string{"a.c"},
+		}
+		objdir := objdir(ctx, pkg)
+		if err := ctx.Mkdir(objdir); err != nil {
+			t.Fatal(err)
+		}
+		args := []string{"-MD", "-I", pkg.Dir}
+		for _, flag := range tt.cflags {
+			args = append(args, strings.Replace(flag, "$TMP", tmp, -1))
+		}
+		args = append(args, "-o", filepath.Join(objdir, "a.o"), "-c", filepath.Join(pkg.Dir, "a.c"))
+		if err := Gcc(ctx, pkg, nil, nil, args).Result(); err != nil {
+			t.Fatalf("%s: gcc: %v", tt.header, err)
+		}
+		inputs, err := readDepfiles(objdir, pkg.Dir, ctx.Workdir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(tmp, "cache", "key")
+		if err := writeCacheEntry(dir, filepath.Join(objdir, "a.o"), inputs); err != nil {
+			t.Fatal(err)
+		}
+		target := &cacheTarget{target: newTarget(ctx, pkg)}
+		if !target.cached(dir) {
+			t.Errorf("%s: cached: expected a hit before the header changed, inputs %q", tt.header, inputs)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmp, filepath.FromSlash(tt.header)), []byte("#define B 2\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if target.cached(dir) {
+			t.Errorf("%s: cached: expected a miss after the header changed, inputs %q", tt.header, inputs)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package build
+
+// build cancellation
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrCancelled is returned by Futures which were abandoned because
+// their Context was cancelled.
+var ErrCancelled = errors.New("build cancelled")
+
+// canceller tracks the processes started on behalf of a Context
+// so they can be terminated if the Context is cancelled.
+type canceller struct {
+	once    sync.Once
+	done    chan struct{}
+	mu      sync.Mutex // protects procs
+	procs   map[*os.Process]bool
+	running sync.WaitGroup
+}
+
+func newCanceller() canceller {
+	return canceller{
+		done:  make(chan struct{}),
+		procs: make(map[*os.Process]bool),
+	}
+}
+
+// Cancel abandons all pending work associated with this Context and
+// terminates any running tools. Futures which have not yet completed
+// will return ErrCancelled. Cancel may be called more than once.
+func (c *canceller) Cancel() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		close(c.done)
+		for p := range c.procs {
+			p.Kill()
+		}
+	})
+}
+
+// Done returns a channel which is closed when the Context is cancelled.
+func (c *canceller) Done() <-chan struct{} { return c.done }
+
+// cancelled reports whether Cancel has been called.
+func (c *canceller) cancelled() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// execute starts cmd and waits for it to complete. If the Context is
+// cancelled before, or while, cmd is running, ErrCancelled is returned.
+func (c *canceller) execute(cmd *exec.Cmd) error {
+	if err := c.start(cmd); err != nil {
+		return err
+	}
+	err := cmd.Wait()
+	c.mu.Lock()
+	delete(c.procs, cmd.Process)
+	c.mu.Unlock()
+	c.running.Done()
+	if c.cancelled() {
+		return ErrCancelled
+	}
+	return err
+}
+
+func (c *canceller) start(cmd *exec.Cmd) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled() {
+		return ErrCancelled
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	c.procs[cmd.Process] = true
+	c.running.Add(1)
+	return nil
+}
+
+// wait blocks until all the processes started by this Context have exited.
+func (c *canceller) wait() { c.running.Wait() }
+
+// WaitDeps waits for deps to complete and returns the first error.
+// If the Context has been cancelled ErrCancelled is returned, so a
+// target does not start work which would be thrown away.
+func (c *canceller) WaitDeps(deps ...Future) error {
+	for _, dep := range deps {
+		if err := dep.Result(); err != nil {
+			return err
+		}
+	}
+	if c.cancelled() {
+		return ErrCancelled
+	}
+	return nil
+}
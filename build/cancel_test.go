@@ -0,0 +1,74 @@
+package build
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCancelKillsRunningTools(t *testing.T) {
+	c := newCanceller()
+	cmd := exec.Command("sleep", "10")
+	result := make(chan error, 1)
+	go func() { result <- c.execute(cmd) }()
+	for {
+		c.mu.Lock()
+		n := len(c.procs)
+		c.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Cancel()
+	select {
+	case err := <-result:
+		if err != ErrCancelled {
+			t.Fatalf("execute: expected %v, got %v", ErrCancelled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("execute: running tool was not terminated")
+	}
+	c.wait()
+}
+
+func TestCancelBeforeStart(t *testing.T) {
+	c := newCanceller()
+	c.Cancel()
+	c.Cancel() // must not panic
+	if err := c.execute(exec.Command("true")); err != ErrCancelled {
+		t.Fatalf("execute: expected %v, got %v", ErrCancelled, err)
+	}
+}
+
+func TestWaitDeps(t *testing.T) {
+	c := newCanceller()
+	if err := c.WaitDeps(errFuture{nil}); err != nil {
+		t.Fatalf("WaitDeps: %v", err)
+	}
+	c.Cancel()
+	if err := c.WaitDeps(errFuture{nil}); err != ErrCancelled {
+		t.Fatalf("WaitDeps: expected %v, got %v", ErrCancelled, err)
+	}
+}
+
+func TestCancelledTargetDoesNotStart(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "gogo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workdir)
+	ctx := &Context{goroot: "/go", goos: "linux", goarch: "amd64", workdir: workdir, canceller: newCanceller()}
+	ctx.Toolchain = &gcToolchain{toolchain: toolchain{Context: ctx}}
+	ctx.Cancel()
+	pkg := &build.Package{ImportPath: "a", Name: "a", Dir: "/src/a", GoFiles: []string{"a.go"}}
+	if err := Compile(ctx, pkg, nil).Result(); err != ErrCancelled {
+		t.Fatalf("Compile: expected %v, got %v", ErrCancelled, err)
+	}
+	if _, err := os.Stat(objdir(ctx, pkg)); !os.IsNotExist(err) {
+		t.Fatalf("Compile: expected %s not to be created after cancellation", objdir(ctx, pkg))
+	}
+}
@@ -14,41 +14,129 @@ import (
 // These filenames are only valid of the Result of the
 // cgo Future is nil.
 func cgo(ctx *Context, pkg *build.Package, deps []Future) ([]ObjFuture, []string) {
-	srcdir := filepath.Join(pkg.SrcRoot, pkg.ImportPath)
+	srcdir := pkg.Dir
 	objdir := objdir(ctx, pkg)
 
+	// check the C tools are installed before invoking any of them.
+	tools := CheckCgoTools(ctx, pkg)
+
+	// flags required by #cgo pkg-config: directives.
+	var cflags, libs []flagsFuture
+	if len(pkg.CgoPkgConfig) > 0 {
+		cflags = []flagsFuture{PkgConfig(ctx, pkg, tools, "--cflags")}
+		libs = []flagsFuture{PkgConfig(ctx, pkg, tools, "--libs")}
+	}
+
 	var args = []string{"-objdir", objdir, "--", "-I", srcdir, "-I", objdir}
+	args = append(args, ctx.CgoCPPFLAGS...)
+	args = append(args, pkg.CgoCPPFLAGS...)
+	args = append(args, ctx.CgoCFLAGS...)
 	args = append(args, pkg.CgoCFLAGS...)
 	var gofiles = []string{filepath.Join(objdir, "_cgo_gotypes.go")}
 	var gccfiles = []string{filepath.Join(objdir, "_cgo_main.c"), filepath.Join(objdir, "_cgo_export.c")}
-	for _, cgofile := range pkg.CgoFiles {
+	var cxxfiles []string
+	for _, cxxfile := range pkg.CXXFiles {
+		cxxfiles = append(cxxfiles, filepath.Join(srcdir, cxxfile))
+	}
+
+	// swig generates a cgo file, and a wrapper, for each interface file.
+	cgofiles := append([]string{}, pkg.CgoFiles...)
+	swigdeps := append([]Future{tools}, deps...)
+	for _, swigfile := range pkg.SwigFiles {
+		gofile, wrapper := swigOutputs(objdir, swigfile, false)
+		cgofiles = append(cgofiles, gofile)
+		gccfiles = append(gccfiles, wrapper)
+		swigdeps = append(swigdeps, Swig(ctx, pkg, tools, swigfile, false))
+	}
+	for _, swigfile := range pkg.SwigCXXFiles {
+		gofile, wrapper := swigOutputs(objdir, swigfile, true)
+		cgofiles = append(cgofiles, gofile)
+		cxxfiles = append(cxxfiles, wrapper)
+		swigdeps = append(swigdeps, Swig(ctx, pkg, tools, swigfile, true))
+	}
+
+	for _, cgofile := range cgofiles {
+		// cgo names its output after the base name of each input.
+		base := strings.TrimSuffix(filepath.Base(cgofile), ".go")
 		args = append(args, cgofile)
-		gofiles = append(gofiles, filepath.Join(objdir, strings.Replace(cgofile, ".go", ".cgo1.go", 1)))
-		gccfiles = append(gccfiles, filepath.Join(objdir, strings.Replace(cgofile, ".go", ".cgo2.c", 1)))
+		gofiles = append(gofiles, filepath.Join(objdir, base+".cgo1.go"))
+		gccfiles = append(gccfiles, filepath.Join(objdir, base+".cgo2.c"))
 	}
 	for _, cfile := range pkg.CFiles {
 		gccfiles = append(gccfiles, filepath.Join(srcdir, cfile))
 	}
-	cgo := Cgo(ctx, pkg, deps, args)
+	cgo := Cgo(ctx, pkg, swigdeps, cflags, args)
 
-	cgodefun := Cc(ctx, pkg, cgo, "_cgo_defun.c")
+	// the Go 1.5 and later toolchain has no C compiler, cgo writes
+	// the Go half of the glue into _cgo_gotypes.go instead.
+	modern := modernGc(ctx)
+	var cgodefun ObjFuture
+	var gccdep Future = cgo
+	if !modern {
+		cgodefun = Cc(ctx, pkg, cgo, "_cgo_defun.c")
+		gccdep = cgodefun
+	}
 
 	var ofiles []string
 	var deps2 []Future
-	for _, gccfile := range gccfiles {
-		args := []string{"-fPIC", "-pthread", "-I", srcdir, "-I", objdir}
-		args = append(args, pkg.CgoCFLAGS...)
-		ofile := gccfile[:len(gccfile)-2] + ".o"
+	compile := func(tool gccFunc, src string, ctxflags, flags []string) {
+		// -MD records the headers src includes, see cachedCompile.
+		args := []string{"-fPIC", "-pthread", "-MD", "-I", srcdir, "-I", objdir}
+		args = append(args, ctx.CgoCPPFLAGS...)
+		args = append(args, pkg.CgoCPPFLAGS...)
+		args = append(args, ctxflags...)
+		args = append(args, flags...)
+		ofile := cgoObjfile(objdir, src)
 		ofiles = append(ofiles, ofile)
-		deps2 = append(deps2, Gcc(ctx, pkg, []Future{cgodefun}, append(args, "-o", ofile, "-c", gccfile)))
+		deps2 = append(deps2, tool(ctx, pkg, []Future{gccdep}, cflags, append(args, "-o", ofile, "-c", src)))
+	}
+	for _, gccfile := range gccfiles {
+		compile(Gcc, gccfile, ctx.CgoCFLAGS, pkg.CgoCFLAGS)
+	}
+	for _, mfile := range pkg.MFiles {
+		compile(Gcc, filepath.Join(srcdir, mfile), ctx.CgoCFLAGS, pkg.CgoCFLAGS)
+	}
+	for _, cxxfile := range cxxfiles {
+		compile(Cxx, cxxfile, ctx.CgoCXXFLAGS, pkg.CgoCXXFLAGS)
+	}
+	for _, ffile := range pkg.FFiles {
+		compile(Fortran, filepath.Join(srcdir, ffile), ctx.CgoFFLAGS, pkg.CgoFFLAGS)
 	}
 
+	// link with the runtime libraries of each language used.
+	link := Gcc
+	if len(cxxfiles) > 0 {
+		link = Cxx
+	}
 	args = []string{"-pthread", "-o", filepath.Join(objdir, "_cgo_.o")}
 	args = append(args, ofiles...)
+	args = append(args, ctx.CgoLDFLAGS...)
 	args = append(args, pkg.CgoLDFLAGS...)
-	gcc := Gcc(ctx, pkg, deps2, args)
+	if len(pkg.MFiles) > 0 {
+		args = append(args, "-lobjc")
+	}
+	if len(pkg.FFiles) > 0 {
+		args = append(args, "-lgfortran")
+	}
+	gcc := link(ctx, pkg, deps2, libs, args)
+
+	if modern {
+		// _cgo_import.go is compiled with the rest of the package,
+		// and the objects of the gcc half are added to the archive
+		// written by compile -pack, as the go command does.
+		gofiles = append(gofiles, filepath.Join(objdir, "_cgo_import.go"))
+		cgoimport := Cgo(ctx, pkg, []Future{gcc}, nil, []string{"-dynpackage", pkg.Name, "-dynimport", filepath.Join(objdir, "_cgo_.o"), "-dynout", filepath.Join(objdir, "_cgo_import.go")})
+		var objs []ObjFuture
+		for _, ofile := range ofiles {
+			if strings.Contains(ofile, "_cgo_main") {
+				continue
+			}
+			objs = append(objs, cgoObj{cgoimport, ofile})
+		}
+		return objs, gofiles
+	}
 
-	cgo = Cgo(ctx, pkg, []Future{gcc}, []string{"-dynimport", filepath.Join(objdir, "_cgo_.o"), "-dynout", filepath.Join(objdir, "_cgo_import.c")})
+	cgo = Cgo(ctx, pkg, []Future{gcc}, nil, []string{"-dynimport", filepath.Join(objdir, "_cgo_.o"), "-dynout", filepath.Join(objdir, "_cgo_import.c")})
 
 	cgoimport := Cc(ctx, pkg, cgo, "_cgo_import.c") // _cgo_import.c is relative to objdir
 
@@ -62,13 +150,10 @@ func cgo(ctx *Context, pkg *build.Package, deps []Future) ([]ObjFuture, []string
 	}
 
 	// more hacking
-	libgcc, err := ctx.Libgcc()
-	if err != nil {
-		panic(err)
-	}
+	libgcc := Libgcc(ctx, pkg, []Future{tools})
 
-	args = append(args, "-Wl,-r", "-nostdlib", libgcc)
-	all := Gcc(ctx, pkg, []Future{cgoimport}, args)
+	args = append(args, "-Wl,-r", "-nostdlib")
+	all := Gcc(ctx, pkg, []Future{cgoimport}, []flagsFuture{libgcc}, args)
 
 	f := &cgoFuture{
 		target: newTarget(ctx, pkg),
@@ -78,6 +163,23 @@ func cgo(ctx *Context, pkg *build.Package, deps []Future) ([]ObjFuture, []string
 	return []ObjFuture{f, cgoimport, cgodefun}, gofiles
 }
 
+// cgoObj is an object file of the gcc half of a cgo package,
+// which is complete once dep, the last step of cgo, is.
+type cgoObj struct {
+	dep     Future
+	objfile string
+}
+
+func (o cgoObj) Result() error   { return o.dep.Result() }
+func (o cgoObj) Objfile() string { return o.objfile }
+
+// modernGc reports whether ctx builds with the Go 1.5 and later gc
+// toolchain, which has no C compiler.
+func modernGc(ctx *Context) bool {
+	t, ok := ctx.Toolchain.(*gcToolchain)
+	return ok && t.modern
+}
+
 type cgoFuture struct {
 	target
 	dep Future
@@ -94,11 +196,12 @@ type nilFuture struct{}
 func (*nilFuture) Result() error { return nil }
 
 // Cgo returns a Future representing the result of running the
-// cgo command.
-func Cgo(ctx *Context, pkg *build.Package, deps []Future, args []string) Future {
+// cgo command. The results of flags are passed to gcc by cgo.
+func Cgo(ctx *Context, pkg *build.Package, deps []Future, flags []flagsFuture, args []string) Future {
 	cgo := &cgoTarget{
 		target: newTarget(ctx, pkg),
 		deps:   deps,
+		flags:  flags,
 		args:   args,
 	}
 	go cgo.execute()
@@ -117,14 +220,64 @@ func Cc(ctx *Context, pkg *build.Package, dep Future, cfile string) ObjFuture {
 	return cc
 }
 
+// gccFunc is the signature of Gcc, Cxx and Fortran.
+type gccFunc func(*Context, *build.Package, []Future, []flagsFuture, []string) Future
+
 // Gcc returns a Future representing the result of invoking the
-// system gcc compiler.
-func Gcc(ctx *Context, pkg *build.Package, deps []Future, args []string) Future {
+// system gcc compiler. The results of flags are appended to args.
+func Gcc(ctx *Context, pkg *build.Package, deps []Future, flags []flagsFuture, args []string) Future {
+	return newGccTarget(ctx, pkg, "gcc", deps, flags, args)
+}
+
+// Cxx returns a Future representing the result of invoking the
+// system C++ compiler. The results of flags are appended to args.
+func Cxx(ctx *Context, pkg *build.Package, deps []Future, flags []flagsFuture, args []string) Future {
+	return newGccTarget(ctx, pkg, "g++", deps, flags, args)
+}
+
+// Fortran returns a Future representing the result of invoking the
+// system Fortran compiler. The results of flags are appended to args.
+func Fortran(ctx *Context, pkg *build.Package, deps []Future, flags []flagsFuture, args []string) Future {
+	return newGccTarget(ctx, pkg, "gfortran", deps, flags, args)
+}
+
+func newGccTarget(ctx *Context, pkg *build.Package, action string, deps []Future, flags []flagsFuture, args []string) Future {
 	gcc := &gccTarget{
 		target: newTarget(ctx, pkg),
+		action: action,
 		deps:   deps,
+		flags:  flags,
 		args:   args,
 	}
 	go gcc.execute()
 	return gcc
 }
+
+// cgoObjfile returns the name of the object file produced by
+// compiling the C, C++, Objective-C or Fortran source file src.
+func cgoObjfile(objdir, src string) string {
+	base := filepath.Base(src)
+	ext := filepath.Ext(base)
+	if ext == ".c" {
+		return filepath.Join(objdir, strings.TrimSuffix(base, ext)+".o")
+	}
+	// keep the extension so a.c and a.cc do not collide.
+	return filepath.Join(objdir, strings.TrimSuffix(base, ext)+"_"+ext[1:]+".o")
+}
+
+// insertFlags returns a copy of the cgo command line args with
+// flags, destined for gcc, inserted after the -- separator.
+func insertFlags(args, flags []string) []string {
+	if len(flags) == 0 {
+		return args
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			var r []string
+			r = append(r, args[:i+1]...)
+			r = append(r, flags...)
+			return append(r, args[i+1:]...)
+		}
+	}
+	return append(append([]string{}, args...), append([]string{"--"}, flags...)...)
+}
@@ -0,0 +1,80 @@
+package build
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var cgoObjfileTests = []struct {
+	src, want string
+}{
+	{"/obj/_cgo_main.c", "/obj/_cgo_main.o"},
+	{"/obj/a.cgo2.c", "/obj/a.cgo2.o"},
+	{"/src/a.c", "/obj/a.o"},
+	{"/src/a.cc", "/obj/a_cc.o"},
+	{"/src/a.m", "/obj/a_m.o"},
+	{"/src/a.f90", "/obj/a_f90.o"},
+}
+
+func TestCgoObjfile(t *testing.T) {
+	for _, tt := range cgoObjfileTests {
+		if got := cgoObjfile("/obj", tt.src); got != tt.want {
+			t.Errorf("cgoObjfile(%q): expected %q, got %q", tt.src, tt.want, got)
+		}
+	}
+}
+
+var checkToolsTests = []struct {
+	tools []cgoTool
+	err   string
+}{
+	{nil, ""},
+	{[]cgoTool{{"C compiler", "sh", "CC"}}, ""},
+	{[]cgoTool{{"C compiler", "gogo-no-such-cc", "CC"}}, `could not find C compiler "gogo-no-such-cc" (set CC to use another)`},
+	{[]cgoTool{{"C compiler", "sh -e", "CC"}}, ""},
+	{[]cgoTool{{"C compiler", "gogo-no-such-cc -m32", "CC"}}, `could not find C compiler "gogo-no-such-cc" (set CC to use another)`},
+	{[]cgoTool{{"C compiler", "sh", "CC"}, {"swig", "gogo-no-such-swig", ""}}, `could not find swig "gogo-no-such-swig"`},
+}
+
+func TestCheckTools(t *testing.T) {
+	for _, tt := range checkToolsTests {
+		err := checkTools(tt.tools)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("checkTools(%v): %v", tt.tools, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("checkTools(%v): expected %q, got %v", tt.tools, tt.err, err)
+		}
+	}
+}
+
+var gccCommandTests = []struct {
+	cc   string
+	want string
+}{
+	{"gcc", "gcc -c a.c"},
+	{"ccache gcc", "ccache gcc -c a.c"},
+	{"clang -m32", "clang -m32 -c a.c"},
+	{"'/opt/my cc/bin/gcc' -m32", "'/opt/my cc/bin/gcc' -m32 -c a.c"},
+}
+
+// TestGccCommand checks that any arguments included in CC precede
+// those passed to the C compiler.
+func TestGccCommand(t *testing.T) {
+	for _, tt := range gccCommandTests {
+		var buf bytes.Buffer
+		ctx := &Context{goroot: "/go", goos: "linux", goarch: "amd64", workdir: "/work", CC: tt.cc, DryRun: true}
+		ctx.printer = printer{w: &buf, workdir: "/work", header: true}
+		ctx.Toolchain = &gcToolchain{toolchain: toolchain{gcc: ctx.CC, Context: ctx}}
+		if err := ctx.Gcc("/src", []string{"-c", "a.c"}); err != nil {
+			t.Fatalf("Gcc with CC=%q: %v", tt.cc, err)
+		}
+		if got := buf.String(); got != "cd /src\n"+tt.want+"\n" {
+			t.Errorf("Gcc with CC=%q: expected %q, got %q", tt.cc, tt.want, got)
+		}
+	}
+}
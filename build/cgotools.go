@@ -0,0 +1,139 @@
+package build
+
+// cgo tool discovery
+
+import (
+	"fmt"
+	"go/build"
+	"os/exec"
+	"strings"
+
+	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
+)
+
+// cgoTool describes an external tool required to build a cgo package.
+type cgoTool struct {
+	desc    string // eg. C compiler
+	command string // eg. gcc
+	env     string // the variable which selects the command, eg. CC
+}
+
+// cgoTools returns the tools required to build pkg with cgo.
+func cgoTools(ctx *Context, pkg *build.Package) []cgoTool {
+	tools := []cgoTool{{"C compiler", ctx.CC, "CC"}}
+	if len(pkg.CXXFiles) > 0 || len(pkg.SwigCXXFiles) > 0 {
+		tools = append(tools, cgoTool{"C++ compiler", ctx.CXX, "CXX"})
+	}
+	if len(pkg.FFiles) > 0 {
+		tools = append(tools, cgoTool{"Fortran compiler", ctx.FC, "FC"})
+	}
+	if len(pkg.SwigFiles) > 0 || len(pkg.SwigCXXFiles) > 0 {
+		tools = append(tools, cgoTool{"swig", "swig", ""})
+	}
+	if len(pkg.CgoPkgConfig) > 0 {
+		tools = append(tools, cgoTool{"pkg-config", ctx.PkgConfig, "PKG_CONFIG"})
+	}
+	return tools
+}
+
+// checkTools returns an error naming each of tools which cannot be
+// found in $PATH.
+func checkTools(tools []cgoTool) error {
+	var missing []string
+	for _, tool := range tools {
+		// commands like CC may include arguments, eg. ccache gcc.
+		command := tool.command
+		if words, err := project.SplitQuoted(command); err == nil && len(words) > 0 {
+			command = words[0]
+		}
+		if _, err := exec.LookPath(command); err == nil {
+			continue
+		}
+		msg := fmt.Sprintf("%s %q", tool.desc, command)
+		if tool.env != "" {
+			msg += fmt.Sprintf(" (set %s to use another)", tool.env)
+		}
+		missing = append(missing, msg)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("could not find %s", strings.Join(missing, ", "))
+}
+
+// CheckCgoTools returns a Future representing the result of checking
+// that the tools required to build pkg with cgo are installed.
+func CheckCgoTools(ctx *Context, pkg *build.Package) Future {
+	t := &cgoToolsTarget{
+		target: newTarget(ctx, pkg),
+	}
+	go t.execute()
+	return t
+}
+
+// cgoToolsTarget implements a Future that represents checking for
+// the tools required by cgo.
+type cgoToolsTarget struct {
+	target
+}
+
+func (t *cgoToolsTarget) execute() {
+	if err := t.WaitDeps(); err != nil {
+		t.err <- err
+		return
+	}
+	log.Debugf("cgo tools %q", t.ImportPath)
+	if err := checkTools(cgoTools(t.Context, t.Package)); err != nil {
+		t.err <- t.Report(t.Package, "cgo", &Error{Err: err})
+		return
+	}
+	t.err <- nil
+}
+
+// Libgcc returns a flagsFuture representing the path to the compiler
+// support library, libgcc, which is linked into each cgo package.
+func Libgcc(ctx *Context, pkg *build.Package, deps []Future) flagsFuture {
+	t := &libgccTarget{
+		target: newTarget(ctx, pkg),
+		deps:   deps,
+	}
+	go t.execute()
+	return t
+}
+
+// libgccTarget implements a flagsFuture that represents asking the C
+// compiler for the location of libgcc.
+type libgccTarget struct {
+	target
+	deps  []Future
+	flags []string
+}
+
+func (t *libgccTarget) execute() {
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
+	}
+	t.err <- t.build()
+}
+
+func (t *libgccTarget) build() error {
+	libgcc, err := t.Toolchain.Libgcc()
+	if err == ErrCancelled {
+		return err
+	}
+	if err != nil {
+		return t.Report(t.Package, "libgcc", &Error{Err: fmt.Errorf("could not locate libgcc: %v", err)})
+	}
+	if libgcc == "" {
+		return t.Report(t.Package, "libgcc", &Error{Err: fmt.Errorf("%s did not report the location of libgcc", t.CC)})
+	}
+	t.flags = []string{libgcc}
+	return nil
+}
+
+func (t *libgccTarget) Flags() []string {
+	t.Result()
+	return t.flags
+}
@@ -3,8 +3,10 @@ package build
 import (
 	"fmt"
 	"go/build"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sync"
@@ -17,13 +19,56 @@ type Context struct {
 	project.Resolver
 	goroot, goos, goarch string
 	workdir, archchar    string
+	root                 string // project root
+	instrument           string // race, msan, asan, or empty
 
 	targetCache
+	keys    keyCache
+	stdlibs stdlibCache
 
 	project.Statistics
 
 	Toolchain
 	SearchPaths []string
+
+	// DryRun causes tool invocations to be printed, but not executed.
+	DryRun bool
+
+	// Trace causes tool invocations to be printed as they are executed.
+	Trace bool
+
+	// PkgConfig is the pkg-config command used to find the flags
+	// of packages named by #cgo pkg-config: directives. It defaults
+	// to $PKG_CONFIG, or pkg-config.
+	PkgConfig string
+
+	// CC, CXX and FC are the C, C++ and Fortran compilers used to
+	// build cgo packages. They default to $CC, $CXX and $FC, or gcc,
+	// g++ and gfortran. Each may include arguments, like "ccache gcc"
+	// or "clang -m32", which precede those gogo passes.
+	CC, CXX, FC string
+
+	// CgoCPPFLAGS, CgoCFLAGS, CgoCXXFLAGS, CgoFFLAGS and CgoLDFLAGS
+	// are passed to the compilers and linker of cgo packages ahead of
+	// the flags of the package's #cgo directives. They default to
+	// $CGO_CPPFLAGS, $CGO_CFLAGS and so on.
+	CgoCPPFLAGS, CgoCFLAGS, CgoCXXFLAGS, CgoFFLAGS, CgoLDFLAGS []string
+
+	// cgoEnabled is false if CGO_ENABLED=0, in which case cgo and
+	// swig files are not built.
+	cgoEnabled bool
+
+	// Cache is the directory in which the archives of cgo packages
+	// are kept between builds. If Cache is empty cgo packages are
+	// always rebuilt.
+	Cache string
+
+	// KeepWorkdir prevents Destroy from removing the work directory.
+	KeepWorkdir bool
+
+	printer
+	canceller
+	reporter
 }
 
 type targetCache struct {
@@ -58,18 +103,45 @@ func NewContext(p *project.Project, toolchain, goroot, goos, goarch string) (*Co
 	if err != nil {
 		return nil, err
 	}
+	// Go 1.5 and later have no architecture letter.
 	archchar, err := build.ArchChar(goarch)
-	if err != nil {
+	if err != nil && !modernTools(goroot, goos, goarch) {
 		return nil, err
 	}
 	ctx := &Context{
-		Resolver: p,
-		goroot:   goroot,
-		goos:     goos,
-		goarch:   goarch,
-		workdir:  workdir,
-		archchar: archchar,
-		// cgoEnabled: true,
+		Resolver:   p,
+		goroot:     goroot,
+		goos:       goos,
+		goarch:     goarch,
+		workdir:    workdir,
+		archchar:   archchar,
+		root:       p.Root(),
+		cgoEnabled: p.CgoEnabled(),
+		CC:         getenv(p, "CC", "gcc"),
+		CXX:        getenv(p, "CXX", "g++"),
+		FC:         getenv(p, "FC", "gfortran"),
+		PkgConfig:  getenv(p, "PKG_CONFIG", "pkg-config"),
+	}
+	for _, v := range []struct{ key, cmdline string }{
+		{"CC", ctx.CC}, {"CXX", ctx.CXX}, {"FC", ctx.FC},
+	} {
+		if _, _, err := splitCommand(v.cmdline); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", v.key, err)
+		}
+	}
+	for _, v := range []struct {
+		flags    *[]string
+		key, def string
+	}{
+		{&ctx.CgoCPPFLAGS, "CGO_CPPFLAGS", ""},
+		{&ctx.CgoCFLAGS, "CGO_CFLAGS", "-g -O2"},
+		{&ctx.CgoCXXFLAGS, "CGO_CXXFLAGS", "-g -O2"},
+		{&ctx.CgoFFLAGS, "CGO_FFLAGS", "-g -O2"},
+		{&ctx.CgoLDFLAGS, "CGO_LDFLAGS", "-g -O2"},
+	} {
+		if *v.flags, err = p.GetenvList(v.key, v.def); err != nil {
+			return nil, err
+		}
 	}
 	f, ok := toolchains[toolchain]
 	if !ok {
@@ -81,18 +153,45 @@ func NewContext(p *project.Project, toolchain, goroot, goos, goarch string) (*Co
 	}
 	ctx.Toolchain = tc
 	ctx.SearchPaths = []string{ctx.stdlib(), workdir}
+	ctx.printer = printer{w: os.Stderr, workdir: workdir}
+	ctx.canceller = newCanceller()
 	return ctx, nil
 }
 
-// Destroy removes any temporary files associated with this Context.
+// getenv returns the value of the project variable key, or def if
+// it is empty.
+func getenv(p *project.Project, key, def string) string {
+	if v := p.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Destroy removes any temporary files associated with this Context,
+// unless KeepWorkdir is set. Destroy waits for any running tools to
+// exit before removing their files.
 func (ctx *Context) Destroy() error {
+	ctx.wait()
+	if ctx.KeepWorkdir {
+		return nil
+	}
 	return os.RemoveAll(ctx.workdir)
 }
 
 // Workdir returns the path to the temporary working directory for this context.
-// The contents of Workdir are removed when the Destroy method is invoked.
+// The contents of Workdir are removed when the Destroy method is invoked,
+// unless KeepWorkdir is set.
 func (ctx *Context) Workdir() string { return ctx.workdir }
 
+// GOROOT returns the Go installation this Context builds with.
+func (ctx *Context) GOROOT() string { return ctx.goroot }
+
+// GOOS returns the operating system this Context builds for.
+func (ctx *Context) GOOS() string { return ctx.goos }
+
+// GOARCH returns the architecture this Context builds for.
+func (ctx *Context) GOARCH() string { return ctx.goarch }
+
 // Bindir returns the path when final binary executables will be stored.
 func (ctx *Context) Bindir() string {
 	// TODO(dfc) hack, don't want to make Context depend on Project
@@ -105,13 +204,93 @@ func (ctx *Context) Bindir() string {
 func (c *Context) Mkdir(path string) error {
 	// TODO(dfc) insert cache
 	log.Debugf("mkdir %q", path)
+	if c.DryRun || c.Trace {
+		c.printf("mkdir -p %s\n", c.shorten(path))
+	}
+	if c.DryRun {
+		return nil
+	}
 	return os.MkdirAll(path, 0777)
 }
 
+// WriteFile writes data to the file named path. If DryRun is set
+// the contents of the file are printed, but the file is not written.
+func (c *Context) WriteFile(path string, data []byte) error {
+	if c.DryRun || c.Trace {
+		c.printf("cat >%s << 'EOF'\n%sEOF\n", c.shorten(path), data)
+	}
+	if c.DryRun {
+		return nil
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+// Copy copies the file src to dst. If DryRun is set the copy
+// is printed, but not performed.
+func (c *Context) Copy(dst, src string) error {
+	if c.DryRun || c.Trace {
+		c.printf("cp %s %s\n", c.shorten(src), c.shorten(dst))
+	}
+	if c.DryRun {
+		return nil
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Run runs cmd. If DryRun is set, cmd is printed but not run.
+// If Trace is set, cmd is printed before it is run.
+func (c *Context) Run(cmd *exec.Cmd) error {
+	c.Print(cmd)
+	if c.DryRun {
+		return c.err()
+	}
+	return c.execute(cmd)
+}
+
+// Print prints cmd, as Run would, if DryRun or Trace are set.
+func (c *Context) Print(cmd *exec.Cmd) {
+	if c.DryRun || c.Trace {
+		c.printcmd(cmd)
+	}
+}
+
+// err returns ErrCancelled if the Context has been cancelled.
+func (c *Context) err() error {
+	if c.cancelled() {
+		return ErrCancelled
+	}
+	return nil
+}
+
 // Pkgdir returns the path to the temporary location where intermediary packages
 // are created during build and test phases.
 func (ctx *Context) Pkgdir() string {
-	return filepath.Join(ctx.workdir, "pkg", ctx.Toolchain.name(), ctx.goos, ctx.goarch)
+	return filepath.Join(ctx.workdir, "pkg", ctx.Toolchain.name(), ctx.goos, ctx.goarch+ctx.suffix())
 }
 
-func (ctx *Context) stdlib() string { return filepath.Join(ctx.goroot, "pkg", ctx.goos+"_"+ctx.goarch) }
+// stdlib returns the directory holding the archives of the standard
+// library; $GOROOT/pkg, or if they are not installed there, a directory
+// in Workdir populated by installStdlib.
+func (ctx *Context) stdlib() string {
+	if !ctx.stdlibInstalled() {
+		return filepath.Join(ctx.workdir, "stdlib", ctx.goos+"_"+ctx.goarch+ctx.suffix())
+	}
+	return filepath.Join(ctx.goroot, "pkg", ctx.goos+"_"+ctx.goarch+ctx.suffix())
+}
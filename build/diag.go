@@ -0,0 +1,141 @@
+package build
+
+// tool diagnostics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/davecheney/gogo/log"
+)
+
+// A Diagnostic is a single message reported by a tool, for example
+// a compiler error.
+type Diagnostic struct {
+	File string // relative to the project root, if the file is inside the project
+	Line int
+	Col  int // zero if the tool did not report a column
+	Msg  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Col > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Col, d.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Msg)
+}
+
+// Error is returned by a Future when a tool fails.
+type Error struct {
+	ImportPath  string // the import path of the package being built
+	Action      string // the step which failed, eg. gc, cc, ld
+	Diagnostics []Diagnostic
+	Output      []byte // tool output which was not recognised as a diagnostic
+	Err         error  // the error returned by the tool itself
+}
+
+func (e *Error) Error() string {
+	prefix := e.Action
+	if e.ImportPath != "" {
+		prefix += " " + e.ImportPath
+	}
+	switch n := len(e.Diagnostics); n {
+	case 0:
+		return fmt.Sprintf("%s: %v", prefix, e.Err)
+	case 1:
+		return fmt.Sprintf("%s: %v", prefix, e.Diagnostics[0])
+	default:
+		return fmt.Sprintf("%s: %v (and %d more)", prefix, e.Diagnostics[0], n-1)
+	}
+}
+
+// diagRe matches file:line: msg and file:line:col: msg.
+var diagRe = regexp.MustCompile(`^([^:\s][^:]*):(\d+):(?:(\d+):)? ?(.*)$`)
+
+// parseDiagnostics parses the output of a tool run in dir into
+// Diagnostics. Paths are rewritten relative to root when they fall
+// inside it. Lines which are not diagnostics are returned unchanged.
+func parseDiagnostics(dir, root string, output []byte) ([]Diagnostic, []byte) {
+	var diags []Diagnostic
+	var rest bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		line := s.Text()
+		if len(diags) > 0 && strings.HasPrefix(line, "\t") {
+			// continuation of the previous diagnostic
+			diags[len(diags)-1].Msg += "\n" + line
+			continue
+		}
+		m := diagRe.FindStringSubmatch(line)
+		if m == nil {
+			rest.WriteString(line)
+			rest.WriteByte('\n')
+			continue
+		}
+		d := Diagnostic{File: relpath(dir, root, m[1]), Msg: m[4]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Col, _ = strconv.Atoi(m[3])
+		diags = append(diags, d)
+	}
+	return diags, rest.Bytes()
+}
+
+// relpath returns file, which may be relative to dir, as a path
+// relative to root. If file is outside root it is returned as an
+// absolute path.
+func relpath(dir, root, file string) string {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	if root == "" {
+		return file
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return rel
+}
+
+// reporter logs Diagnostics, suppressing those that have already been
+// reported by another target.
+type reporter struct {
+	sync.Mutex
+	seen map[Diagnostic]bool
+}
+
+// Report annotates err, returned from a tool run as part of action on
+// pkg, with the package and action, and logs any new diagnostics. The
+// annotated error is returned. Errors which did not come from a tool
+// are returned unchanged.
+func (c *Context) Report(pkg *build.Package, action string, err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return err
+	}
+	e.ImportPath = pkg.ImportPath
+	e.Action = action
+	c.reporter.Lock()
+	defer c.reporter.Unlock()
+	if c.reporter.seen == nil {
+		c.reporter.seen = make(map[Diagnostic]bool)
+	}
+	for _, d := range e.Diagnostics {
+		if c.reporter.seen[d] {
+			continue
+		}
+		c.reporter.seen[d] = true
+		log.Errorf("%s %s: %v", action, pkg.ImportPath, d)
+	}
+	if len(e.Output) > 0 {
+		log.Errorf("%s %s:\n%s", action, pkg.ImportPath, e.Output)
+	}
+	return e
+}
@@ -0,0 +1,60 @@
+package build
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var parseDiagnosticsTests = []struct {
+	output string
+	diags  []Diagnostic
+	rest   string
+}{
+	{
+		output: "a1.go:3: undefined: foo\n",
+		diags:  []Diagnostic{{File: "src/a/a1.go", Line: 3, Msg: "undefined: foo"}},
+	},
+	{
+		output: "./a1.go:3:7: undefined: foo\n\thave ()\n\twant (int)\n",
+		diags:  []Diagnostic{{File: "src/a/a1.go", Line: 3, Col: 7, Msg: "undefined: foo\n\thave ()\n\twant (int)"}},
+	},
+	{
+		output: "/usr/include/stdio.h:10:2: error: oops\nlinker failed\n",
+		diags:  []Diagnostic{{File: "/usr/include/stdio.h", Line: 10, Col: 2, Msg: "error: oops"}},
+		rest:   "linker failed\n",
+	},
+	{
+		output: "too many errors\n",
+		rest:   "too many errors\n",
+	},
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	for _, tt := range parseDiagnosticsTests {
+		diags, rest := parseDiagnostics("/project/src/a", "/project", []byte(tt.output))
+		if !reflect.DeepEqual(diags, tt.diags) {
+			t.Errorf("parseDiagnostics(%q): expected %v, got %v", tt.output, tt.diags, diags)
+		}
+		if string(rest) != tt.rest {
+			t.Errorf("parseDiagnostics(%q): expected rest %q, got %q", tt.output, tt.rest, rest)
+		}
+	}
+}
+
+var errorTests = []struct {
+	err  *Error
+	want string
+}{
+	{&Error{ImportPath: "a", Action: "gc", Err: errors.New("exit status 1")}, "gc a: exit status 1"},
+	{&Error{ImportPath: "a", Action: "gc", Diagnostics: []Diagnostic{{"src/a/a.go", 1, 0, "x"}}}, "gc a: src/a/a.go:1: x"},
+	{&Error{ImportPath: "a", Action: "gc", Diagnostics: []Diagnostic{{"src/a/a.go", 1, 2, "x"}, {"src/a/a.go", 2, 0, "y"}}}, "gc a: src/a/a.go:1:2: x (and 1 more)"},
+}
+
+func TestErrorString(t *testing.T) {
+	for _, tt := range errorTests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error(): expected %q, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package build
+
+// go:embed support
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/davecheney/gogo/project"
+)
+
+// embedcfg is the format of the -embedcfg file read by the compiler.
+type embedcfg struct {
+	Patterns map[string][]string
+	Files    map[string]string
+}
+
+// embedConfig returns the embedcfg for the //go:embed patterns of
+// the package in srcdir.
+func embedConfig(srcdir string, patterns []string) ([]byte, error) {
+	files, pmap, err := project.ResolveEmbed(srcdir, patterns)
+	if err != nil {
+		return nil, err
+	}
+	cfg := embedcfg{
+		Patterns: pmap,
+		Files:    make(map[string]string),
+	}
+	for _, file := range files {
+		cfg.Files[file] = filepath.Join(srcdir, filepath.FromSlash(file))
+	}
+	data, err := json.MarshalIndent(&cfg, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,33 @@
+package build
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEmbedConfig(t *testing.T) {
+	srcdir, err := filepath.Abs("../testdata/src/embeddata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := embedConfig(srcdir, []string{"hello.txt", "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg embedcfg
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"hello.txt": {"hello.txt"},
+		"static":    {"static/a.txt", "static/sub/b.txt"},
+	}
+	if !reflect.DeepEqual(cfg.Patterns, want) {
+		t.Errorf("embedConfig: expected patterns %q, got %q", want, cfg.Patterns)
+	}
+	if got, want := cfg.Files["static/sub/b.txt"], filepath.Join(srcdir, "static", "sub", "b.txt"); got != want {
+		t.Errorf("embedConfig: expected %q, got %q", want, got)
+	}
+}
@@ -3,70 +3,172 @@ package build
 // gc toolchain
 
 import (
+	"errors"
 	"go/build"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 type gcToolchain struct {
 	toolchain
 	gc, cc, ld, as, pack string
+
+	// modern is set for Go 1.5 and later, where the tools are
+	// named compile, asm and link, and there is no C compiler.
+	modern bool
+}
+
+// modernTools reports whether the gc toolchain in goroot is Go 1.5
+// or later, which replaced the 6g, 6l and 6a tools with compile, link
+// and asm.
+func modernTools(goroot, goos, goarch string) bool {
+	_, err := os.Stat(filepath.Join(goroot, "pkg", "tool", goos+"_"+goarch, "compile"))
+	return err == nil
 }
 
 func newGcToolchain(c *Context) (Toolchain, error) {
 	tooldir := filepath.Join(c.goroot, "pkg", "tool", c.goos+"_"+c.goarch)
+	tc := toolchain{
+		cgo:     filepath.Join(tooldir, "cgo"),
+		gcc:     c.CC,
+		cxx:     c.CXX,
+		fc:      c.FC,
+		swig:    "swig",
+		Context: c,
+	}
+	if modernTools(c.goroot, c.goos, c.goarch) {
+		return &gcToolchain{
+			toolchain: tc,
+			gc:        filepath.Join(tooldir, "compile"),
+			ld:        filepath.Join(tooldir, "link"),
+			as:        filepath.Join(tooldir, "asm"),
+			pack:      filepath.Join(tooldir, "pack"),
+			modern:    true,
+		}, nil
+	}
 	archchar, err := build.ArchChar(c.goarch)
 	if err != nil {
 		return nil, err
 	}
 	return &gcToolchain{
-		toolchain: toolchain{
-			cgo:     filepath.Join(tooldir, "cgo"),
-			gcc:     "/usr/bin/gcc",
-			Context: c,
-		},
-		gc:   filepath.Join(tooldir, archchar+"g"),
-		cc:   filepath.Join(tooldir, archchar+"c"),
-		ld:   filepath.Join(tooldir, archchar+"l"),
-		as:   filepath.Join(tooldir, archchar+"a"),
-		pack: filepath.Join(tooldir, "pack"),
+		toolchain: tc,
+		gc:        filepath.Join(tooldir, archchar+"g"),
+		cc:        filepath.Join(tooldir, archchar+"c"),
+		ld:        filepath.Join(tooldir, archchar+"l"),
+		as:        filepath.Join(tooldir, archchar+"a"),
+		pack:      filepath.Join(tooldir, "pack"),
 	}, nil
 }
 
+// errNoEmbed is returned when a package using //go:embed is compiled
+// by a toolchain which does not support it.
+var errNoEmbed = errors.New("//go:embed requires Go 1.16 or later")
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// errNoVendor is returned when a package with vendored imports is
+// compiled by a toolchain which does not support -importmap.
+var errNoVendor = errors.New("vendored imports require Go 1.5 or later")
+
 func (t *gcToolchain) name() string { return "gc" }
 
-func (t *gcToolchain) Gc(importpath, srcdir, outfile string, files []string) error {
+func (t *gcToolchain) Gc(importpath, srcdir, outfile, embedcfg string, importmap map[string]string, files []string) error {
+	if embedcfg != "" && !t.modern {
+		return errNoEmbed
+	}
+	if len(importmap) > 0 && !t.modern {
+		return errNoVendor
+	}
 	args := []string{"-p", importpath}
+	if t.instrument != "" {
+		args = append(args, "-"+t.instrument)
+	}
 	for _, d := range t.SearchPaths {
 		args = append(args, "-I", d)
 	}
 	args = append(args, "-o", outfile)
+	if t.modern {
+		// there is no pack tool to add the export data, see Pack.
+		args = append(args, "-pack")
+	}
+	if embedcfg != "" {
+		args = append(args, "-embedcfg", embedcfg)
+	}
+	for _, path := range sortedKeys(importmap) {
+		args = append(args, "-importmap", path+"="+importmap[path])
+	}
 	args = append(args, files...)
-	return run(srcdir, t.gc, args...)
+	return t.run(srcdir, nil, t.gc, args...)
 }
 
 func (t *gcToolchain) Cc(srcdir, objdir, outfile, cfile string) error {
+	if t.modern {
+		return errors.New("the Go 1.5 and later toolchain has no C compiler")
+	}
 	args := []string{"-F", "-V", "-w", "-I", objdir, "-I", filepath.Join(t.goroot, "pkg", t.goos+"_"+t.goarch)}
 	args = append(args, "-o", outfile)
 	args = append(args, cfile)
-	return run(srcdir, t.cc, args...)
+	return t.run(srcdir, nil, t.cc, args...)
 }
 
 func (t *gcToolchain) Pack(afile string, ofiles ...string) error {
+	if t.modern {
+		// recent toolchains ship no pack tool, so the objects are
+		// added to the archive written by compile -pack as pack r
+		// would, like the go command does.
+		cmd := newCmd(filepath.Dir(afile), nil, t.pack, append([]string{"r", afile}, ofiles...)...)
+		t.Print(cmd)
+		if t.DryRun {
+			return t.err()
+		}
+		if err := packArchive(afile, ofiles); err != nil {
+			return &Error{Err: err}
+		}
+		return nil
+	}
 	args := []string{"grcP", t.Workdir(), afile}
 	args = append(args, ofiles...)
-	return run(filepath.Dir(afile), t.pack, args...)
+	return t.run(filepath.Dir(afile), nil, t.pack, args...)
 }
 
 func (t *gcToolchain) Asm(srcdir, ofile, sfile string) error {
-	args := []string{"-o", ofile, "-D", "GOOS_" + t.goos, "-D", "GOARCH_" + t.goarch, sfile}
-	return run(srcdir, t.as, args...)
+	args := []string{"-o", ofile, "-D", "GOOS_" + t.goos, "-D", "GOARCH_" + t.goarch}
+	if t.modern {
+		args = append(args, "-I", filepath.Join(t.goroot, "pkg", "include"))
+	}
+	args = append(args, sfile)
+	return t.run(srcdir, nil, t.as, args...)
 }
 
 func (t *gcToolchain) Ld(outfile, afile string) error {
 	args := []string{"-o", outfile}
+	if t.instrument != "" {
+		args = append(args, "-"+t.instrument)
+	}
+	if t.instrument == MSan || t.instrument == ASan {
+		// the sanitizer runtimes are linked by the C compiler.
+		extld, extra, err := splitCommand(t.CC)
+		if err != nil {
+			return &Error{Err: err}
+		}
+		args = append(args, "-linkmode=external", "-extld", extld)
+		if len(extra) > 0 {
+			args = append(args, "-extldflags", strings.Join(extra, " "))
+		}
+	}
 	for _, d := range t.SearchPaths {
 		args = append(args, "-L", d)
 	}
 	args = append(args, afile)
-	return run(t.Workdir(), t.ld, args...)
+	return t.run(t.Workdir(), nil, t.ld, args...)
 }
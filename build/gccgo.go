@@ -3,6 +3,7 @@ package build
 // gccgo toolchain
 
 import (
+	"errors"
 	"path/filepath"
 )
 
@@ -16,7 +17,10 @@ func newGccgoToolchain(c *Context) (Toolchain, error) {
 	return &gccgoToolchain{
 		toolchain: toolchain{
 			cgo:     filepath.Join(tooldir, "cgo"),
-			gcc:     "/usr/bin/gcc",
+			gcc:     c.CC,
+			cxx:     c.CXX,
+			fc:      c.FC,
+			swig:    "swig",
 			Context: c,
 		},
 		gccgo: "gccgo",
@@ -25,7 +29,10 @@ func newGccgoToolchain(c *Context) (Toolchain, error) {
 
 func (t *gccgoToolchain) name() string { return "gc" }
 
-func (t *gccgoToolchain) Gc(importpath, srcdir, outfile string, files []string) error {
+func (t *gccgoToolchain) Gc(importpath, srcdir, outfile, embedcfg string, importmap map[string]string, files []string) error {
+	if len(importmap) > 0 {
+		return errors.New("vendored imports are not supported by gccgo")
+	}
 	args := []string{"-c", "-g", "-m64"}
 	for _, d := range t.SearchPaths {
 		args = append(args, "-I", d)
@@ -33,15 +40,18 @@ func (t *gccgoToolchain) Gc(importpath, srcdir, outfile string, files []string)
 	args = append(args, "-fgo-pkgpath="+importpath)
 	args = append(args, "-fgo-relative-import-path=_"+srcdir)
 	args = append(args, "-o", outfile)
+	if embedcfg != "" {
+		args = append(args, "-fgo-embedcfg="+embedcfg)
+	}
 	args = append(args, files...)
-	return run(srcdir, t.gccgo, args...)
+	return t.run(srcdir, nil, t.gccgo, args...)
 }
 
 func (t *gccgoToolchain) Cc(srcdir, objdir, outfile, cfile string) error {
 	args := []string{"-F", "-V", "-w", "-I", objdir, "-I", filepath.Join(t.goroot, "pkg", t.goos+"_"+t.goarch)}
 	args = append(args, "-o", outfile)
 	args = append(args, cfile)
-	return run(srcdir, t.gccgo, args...)
+	return t.run(srcdir, nil, t.gccgo, args...)
 }
 
 func (t *gccgoToolchain) Pack(afile string, ofiles ...string) error {
@@ -49,12 +59,12 @@ func (t *gccgoToolchain) Pack(afile string, ofiles ...string) error {
 	dir, file := filepath.Split(afile)
 	args := []string{"cru", filepath.Join(dir, "lib"+file)}
 	args = append(args, ofiles...)
-	return run(filepath.Dir(afile), "ar", args...)
+	return t.run(filepath.Dir(afile), nil, "ar", args...)
 }
 
 func (t *gccgoToolchain) Asm(srcdir, ofile, sfile string) error {
 	args := []string{"-o", ofile, "-D", "GOOS_" + t.goos, "-D", "GOARCH_" + t.goarch, sfile}
-	return run(srcdir, t.gccgo, args...)
+	return t.run(srcdir, nil, t.gccgo, args...)
 }
 
 func (t *gccgoToolchain) Ld(outfile, afile string) error {
@@ -63,5 +73,5 @@ func (t *gccgoToolchain) Ld(outfile, afile string) error {
 		args = append(args, "-L", d)
 	}
 	args = append(args, afile)
-	return run(t.Workdir(), t.gccgo, args...)
+	return t.run(t.Workdir(), nil, t.gccgo, args...)
 }
@@ -0,0 +1,100 @@
+package build
+
+// race detector and sanitizer build modes
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Instrumentation modes which may be passed to SetInstrument.
+const (
+	Race = "race"
+	MSan = "msan"
+	ASan = "asan"
+)
+
+// instrumentPlatforms lists the platforms on which each
+// instrumentation mode is supported.
+var instrumentPlatforms = map[string][]string{
+	Race: {"darwin/amd64", "darwin/arm64", "freebsd/amd64", "linux/amd64", "linux/arm64", "linux/ppc64le", "linux/s390x", "netbsd/amd64", "windows/amd64"},
+	MSan: {"freebsd/amd64", "linux/amd64", "linux/arm64", "linux/loong64"},
+	ASan: {"linux/amd64", "linux/arm64", "linux/loong64", "linux/riscv64", "linux/ppc64le"},
+}
+
+// SetInstrument selects an instrumented build, one of Race, MSan or
+// ASan. Packages are compiled and linked with the matching compiler
+// and linker flag, and against the instrumented standard library in
+// $GOROOT/pkg/$GOOS_$GOARCH_$MODE. An empty mode selects a regular build.
+// SetInstrument must be called before any packages are built.
+func (ctx *Context) SetInstrument(mode string) error {
+	if mode != "" {
+		platforms, ok := instrumentPlatforms[mode]
+		if !ok {
+			return fmt.Errorf("unknown instrumentation mode %q", mode)
+		}
+		if _, ok := ctx.Toolchain.(*gccgoToolchain); ok {
+			return fmt.Errorf("-%s is not supported by the gccgo toolchain", mode)
+		}
+		if !contains(platforms, ctx.goos+"/"+ctx.goarch) {
+			return fmt.Errorf("-%s is not supported on %s/%s", mode, ctx.goos, ctx.goarch)
+		}
+		if mode == MSan && !ctx.isClang() {
+			return fmt.Errorf("-msan requires clang, but CC is %q", ctx.CC)
+		}
+	}
+	ctx.instrument = mode
+	ctx.SearchPaths[0] = ctx.stdlib()
+	return nil
+}
+
+// isClang reports whether the C compiler is clang, which is the only
+// compiler supporting -fsanitize=memory. CC is clang if it is named
+// clang, or if, like cc on many systems, it says so when asked for
+// its version.
+func (ctx *Context) isClang() bool {
+	command, extra, err := splitCommand(ctx.CC)
+	if err != nil {
+		return false
+	}
+	if base := filepath.Base(command); base == "clang" || strings.HasPrefix(base, "clang-") {
+		return true
+	}
+	out, err := ctx.runOut("", nil, command, append(extra, "--version")...)
+	return err == nil && bytes.Contains(out, []byte("clang"))
+}
+
+// Instrument returns the instrumentation mode selected by SetInstrument.
+func (ctx *Context) Instrument() string { return ctx.instrument }
+
+// suffix returns the suffix of package directories for the
+// instrumentation mode of this Context.
+func (ctx *Context) suffix() string {
+	if ctx.instrument == "" {
+		return ""
+	}
+	return "_" + ctx.instrument
+}
+
+// sanitizeFlags returns the flags passed to gcc for the
+// instrumentation mode of this Context.
+func (ctx *Context) sanitizeFlags() []string {
+	switch ctx.instrument {
+	case MSan:
+		return []string{"-fsanitize=memory"}
+	case ASan:
+		return []string{"-fsanitize=address"}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
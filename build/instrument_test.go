@@ -0,0 +1,142 @@
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var setInstrumentTests = []struct {
+	toolchain   string
+	goos        string
+	goarch      string
+	mode        string
+	err         bool
+	stdlib      string
+	pkgdirArch  string
+	sanitizeArg string
+}{
+	{"gc", "linux", "amd64", "", false, "/go/pkg/linux_amd64", "amd64", ""},
+	{"gc", "linux", "amd64", Race, false, "/go/pkg/linux_amd64_race", "amd64_race", ""},
+	{"gc", "linux", "amd64", MSan, false, "/go/pkg/linux_amd64_msan", "amd64_msan", "-fsanitize=memory"},
+	{"gc", "linux", "arm64", ASan, false, "/go/pkg/linux_arm64_asan", "arm64_asan", "-fsanitize=address"},
+	{"gc", "linux", "386", Race, true, "", "", ""},
+	{"gc", "windows", "amd64", ASan, true, "", "", ""},
+	{"gc", "linux", "amd64", "thread", true, "", "", ""},
+	{"gccgo", "linux", "amd64", Race, true, "", "", ""},
+}
+
+func TestSetInstrument(t *testing.T) {
+	for _, tt := range setInstrumentTests {
+		ctx := &Context{goroot: "/go", goos: tt.goos, goarch: tt.goarch, workdir: "/work", CC: "clang"}
+		ctx.Toolchain = &gcToolchain{toolchain: toolchain{Context: ctx}}
+		if tt.toolchain == "gccgo" {
+			ctx.Toolchain = &gccgoToolchain{toolchain: toolchain{Context: ctx}}
+		}
+		ctx.SearchPaths = []string{ctx.stdlib(), ctx.workdir}
+		err := ctx.SetInstrument(tt.mode)
+		if tt.err {
+			if err == nil {
+				t.Errorf("SetInstrument(%q) on %s %s/%s: expected error", tt.mode, tt.toolchain, tt.goos, tt.goarch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetInstrument(%q): %v", tt.mode, err)
+			continue
+		}
+		if got := ctx.SearchPaths[0]; got != tt.stdlib {
+			t.Errorf("SetInstrument(%q): expected stdlib %q, got %q", tt.mode, tt.stdlib, got)
+		}
+		if want := "/work/pkg/gc/" + tt.goos + "/" + tt.pkgdirArch; ctx.Pkgdir() != want {
+			t.Errorf("SetInstrument(%q): expected pkgdir %q, got %q", tt.mode, want, ctx.Pkgdir())
+		}
+		var got string
+		if flags := ctx.sanitizeFlags(); len(flags) > 0 {
+			got = flags[0]
+		}
+		if got != tt.sanitizeArg {
+			t.Errorf("SetInstrument(%q): expected gcc flag %q, got %q", tt.mode, tt.sanitizeArg, got)
+		}
+	}
+}
+
+// fakeCC writes a C compiler to dir which prints version when run.
+func fakeCC(t *testing.T, dir, name, version string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho '"+version+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMSanRequiresClang(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake C compilers are shell scripts")
+	}
+	tmp, err := ioutil.TempDir("", "gogo-instrument")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tests := []struct {
+		cc string
+		ok bool
+	}{
+		{"clang", true},
+		{"/usr/local/bin/clang-17", true},
+		{"clang -m32", true},
+		{fakeCC(t, tmp, "ccache", "Ubuntu clang version 17.0.6") + " clang", true},
+		{fakeCC(t, tmp, "cc", "Ubuntu clang version 17.0.6"), true},
+		{fakeCC(t, tmp, "gcc", "gcc (GCC) 13.2.0"), false},
+		{filepath.Join(tmp, "missing"), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ctx := &Context{goroot: "/go", goos: "linux", goarch: "amd64", workdir: "/work", CC: tt.cc, canceller: newCanceller()}
+		ctx.Toolchain = &gcToolchain{toolchain: toolchain{Context: ctx}}
+		ctx.SearchPaths = []string{ctx.stdlib(), ctx.workdir}
+		err := ctx.SetInstrument(MSan)
+		if tt.ok && err != nil {
+			t.Errorf("SetInstrument(%q) with CC=%q: %v", MSan, tt.cc, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "-msan requires clang")) {
+			t.Errorf("SetInstrument(%q) with CC=%q: expected -msan requires clang error, got %v", MSan, tt.cc, err)
+		}
+	}
+}
+
+var ldInstrumentTests = []struct {
+	mode string
+	cc   string
+	want string
+}{
+	{"", "clang", "link -o out -L /go/pkg/linux_amd64 -L $WORK a.a"},
+	{Race, "clang", "link -o out -race -L /go/pkg/linux_amd64_race -L $WORK a.a"},
+	{MSan, "clang", "link -o out -msan -linkmode=external -extld clang -L /go/pkg/linux_amd64_msan -L $WORK a.a"},
+	{ASan, "clang", "link -o out -asan -linkmode=external -extld clang -L /go/pkg/linux_amd64_asan -L $WORK a.a"},
+	{ASan, "clang -fuse-ld=lld", "link -o out -asan -linkmode=external -extld clang -extldflags -fuse-ld=lld -L /go/pkg/linux_amd64_asan -L $WORK a.a"},
+}
+
+func TestLdInstrument(t *testing.T) {
+	for _, tt := range ldInstrumentTests {
+		var buf bytes.Buffer
+		ctx := &Context{goroot: "/go", goos: "linux", goarch: "amd64", workdir: "/work", CC: tt.cc, DryRun: true}
+		ctx.printer = printer{w: &buf, workdir: "/work", header: true}
+		ctx.Toolchain = &gcToolchain{toolchain: toolchain{Context: ctx}, ld: "link", modern: true}
+		ctx.SearchPaths = []string{ctx.stdlib(), ctx.workdir}
+		if err := ctx.SetInstrument(tt.mode); err != nil {
+			t.Fatalf("SetInstrument(%q): %v", tt.mode, err)
+		}
+		if err := ctx.Ld("out", "a.a"); err != nil {
+			t.Fatalf("Ld: %v", err)
+		}
+		if got := buf.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("Ld with %q: expected %q, got %q", tt.mode, tt.want, got)
+		}
+	}
+}
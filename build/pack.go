@@ -0,0 +1,99 @@
+package build
+
+// writing of Unix ar archives, for toolchains without a pack tool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	arMagic     = "!<arch>\n"
+	arHeaderLen = 60
+)
+
+// arEntry is a member of an ar archive.
+type arEntry struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// packArchive writes the archive afile from ofiles. The members of
+// any archives among ofiles, like those written by compile -pack, come
+// first, so the export data in __.PKGDEF stays the first member. Each
+// remaining object file is added as a member of its own.
+func packArchive(afile string, ofiles []string) error {
+	var archives, objects []arEntry
+	for _, ofile := range ofiles {
+		data, err := ioutil.ReadFile(ofile)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(data, []byte(arMagic)) {
+			objects = append(objects, arEntry{name: filepath.Base(ofile), mode: 0644, data: data})
+			continue
+		}
+		entries, err := readArchive(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", ofile, err)
+		}
+		archives = append(archives, entries...)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, e := range append(archives, objects...) {
+		writeArEntry(&buf, e)
+	}
+	return ioutil.WriteFile(afile, buf.Bytes(), 0666)
+}
+
+// readArchive returns the members of the ar archive data.
+func readArchive(data []byte) ([]arEntry, error) {
+	var entries []arEntry
+	data = data[len(arMagic):]
+	for len(data) > 0 {
+		if len(data) < arHeaderLen || string(data[58:60]) != "`\n" {
+			return nil, errors.New("malformed archive header")
+		}
+		hdr := data[:arHeaderLen]
+		mode, err := strconv.ParseInt(strings.TrimSpace(string(hdr[40:48])), 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed archive header: %v", err)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 || size > int64(len(data)-arHeaderLen) {
+			return nil, errors.New("malformed archive header: bad size")
+		}
+		data = data[arHeaderLen:]
+		entries = append(entries, arEntry{
+			name: strings.TrimSpace(string(hdr[:16])),
+			mode: mode,
+			data: data[:size],
+		})
+		data = data[size:]
+		if size%2 == 1 && len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	return entries, nil
+}
+
+// writeArEntry writes e to w, padded to an even length.
+func writeArEntry(w io.Writer, e arEntry) {
+	name := e.name
+	if len(name) > 16 {
+		name = name[:16]
+	}
+	fmt.Fprintf(w, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, e.mode, len(e.data))
+	w.Write(e.data)
+	if len(e.data)%2 == 1 {
+		w.Write([]byte{'\n'})
+	}
+}
@@ -0,0 +1,53 @@
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackArchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// an archive as written by compile -pack, and an object from gcc.
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	writeArEntry(&buf, arEntry{name: "__.PKGDEF", mode: 0644, data: []byte("export")})
+	writeArEntry(&buf, arEntry{name: "_go_.o", mode: 0644, data: []byte("odd")})
+	gofile := filepath.Join(tmp, "_go_.6")
+	if err := ioutil.WriteFile(gofile, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ofile := filepath.Join(tmp, "a.cgo2.o")
+	if err := ioutil.WriteFile(ofile, []byte("\x7fELF"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	afile := filepath.Join(tmp, "a.a")
+	if err := packArchive(afile, []string{ofile, gofile}); err != nil {
+		t.Fatalf("packArchive: %v", err)
+	}
+	data, err := ioutil.ReadFile(afile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readArchive(data)
+	if err != nil {
+		t.Fatalf("readArchive: %v", err)
+	}
+	want := []arEntry{
+		{"__.PKGDEF", 0644, []byte("export")},
+		{"_go_.o", 0644, []byte("odd")},
+		{"a.cgo2.o", 0644, []byte("\x7fELF")},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("packArchive: expected %+v, got %+v", want, entries)
+	}
+}
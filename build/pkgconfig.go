@@ -0,0 +1,175 @@
+package build
+
+// pkg-config support
+
+import (
+	"fmt"
+	"go/build"
+	"strings"
+	"time"
+
+	"github.com/davecheney/gogo/log"
+)
+
+// flagsFuture represents the result of querying a tool for the
+// flags required to build a package.
+type flagsFuture interface {
+	Future
+
+	// Flags returns the flags reported by the tool.
+	// Flags blocks until the Result is available.
+	Flags() []string
+}
+
+// PkgConfig returns a Future representing the result of asking
+// pkg-config for the flags, either --cflags or --libs, required by
+// the #cgo pkg-config: directives of pkg. pkg-config is invoked once
+// dep has succeeded.
+func PkgConfig(ctx *Context, pkg *build.Package, dep Future, mode string) flagsFuture {
+	t := &pkgConfigTarget{
+		target: newTarget(ctx, pkg),
+		dep:    dep,
+		mode:   mode,
+	}
+	go t.execute()
+	return t
+}
+
+// pkgConfigTarget implements a flagsFuture that represents invoking pkg-config.
+type pkgConfigTarget struct {
+	target
+	dep   Future
+	mode  string
+	flags []string
+}
+
+func (t *pkgConfigTarget) execute() {
+	if err := t.WaitDeps(t.dep); err != nil {
+		t.err <- err
+		return
+	}
+	t.err <- t.build()
+}
+
+func (t *pkgConfigTarget) build() error {
+	t0 := time.Now()
+	opts, pkgs, err := splitPkgConfig(t.CgoPkgConfig)
+	if err != nil {
+		return t.Report(t.Package, "pkg-config", &Error{Err: err})
+	}
+	log.Debugf("pkg-config %q: %s %s", t.ImportPath, t.mode, pkgs)
+	args := append(append([]string{}, opts...), t.mode)
+	args = append(args, pkgs...)
+	out, err := t.runOut(t.Srcdir(), nil, t.PkgConfig, args...)
+	t.Record("pkg-config", time.Since(t0))
+	if err == ErrCancelled {
+		return err
+	}
+	if err != nil {
+		// runOut has already logged the output of pkg-config.
+		return t.Report(t.Package, "pkg-config", &Error{Err: t.missing(opts, pkgs, err)})
+	}
+	if t.flags, err = splitPkgConfigOutput(out); err != nil {
+		return t.Report(t.Package, "pkg-config", &Error{Err: err})
+	}
+	return nil
+}
+
+// missing returns an error naming the packages in pkgs which
+// pkg-config could not find. If pkg-config can find them all
+// err is returned.
+func (t *pkgConfigTarget) missing(opts, pkgs []string, err error) error {
+	var missing []string
+	for _, pkg := range pkgs {
+		args := append(append([]string{}, opts...), "--exists", pkg)
+		if _, err := t.runOut(t.Srcdir(), nil, t.PkgConfig, args...); err != nil {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) == 0 {
+		return err
+	}
+	return fmt.Errorf("could not find %s in the pkg-config search path", strings.Join(missing, ", "))
+}
+
+func (t *pkgConfigTarget) Flags() []string {
+	t.Result()
+	return t.flags
+}
+
+// splitPkgConfig splits the arguments of #cgo pkg-config: directives
+// into options for pkg-config and the names of packages.
+func splitPkgConfig(args []string) (opts, pkgs []string, err error) {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			opts, pkgs = args[:i], args[i:]
+			break
+		}
+		if arg == "--" {
+			opts, pkgs = args[:i], args[i+1:]
+			break
+		}
+	}
+	if pkgs == nil {
+		opts = args
+	}
+	for _, pkg := range pkgs {
+		if pkg == "" || strings.HasPrefix(pkg, "-") {
+			return nil, nil, fmt.Errorf("invalid pkg-config package name: %q", pkg)
+		}
+	}
+	return opts, pkgs, nil
+}
+
+// splitPkgConfigOutput splits the output of pkg-config into flags,
+// honouring the quoting and escaping pkg-config applies to flags
+// containing spaces.
+func splitPkgConfigOutput(out []byte) ([]string, error) {
+	var flags []string
+	var flag []byte
+	var quote byte
+	var escaped, inflag bool
+	for _, c := range out {
+		switch {
+		case escaped:
+			escaped = false
+			flag = append(flag, c)
+		case c == '\\':
+			escaped, inflag = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				flag = append(flag, c)
+			}
+		case c == '"' || c == '\'':
+			quote, inflag = c, true
+		case strings.IndexByte(" \t\r\n", c) >= 0:
+			if inflag {
+				flags = append(flags, string(flag))
+				flag, inflag = flag[:0], false
+			}
+		default:
+			flag, inflag = append(flag, c), true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in pkg-config output: %q", out)
+	}
+	if inflag {
+		flags = append(flags, string(flag))
+	}
+	return flags, nil
+}
+
+// waitFlags waits for each of futures and returns their flags.
+func waitFlags(futures []flagsFuture) ([]string, error) {
+	var flags []string
+	for _, f := range futures {
+		if err := f.Result(); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f.Flags()...)
+	}
+	return flags, nil
+}
@@ -0,0 +1,80 @@
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+var splitPkgConfigTests = []struct {
+	args       []string
+	opts, pkgs []string
+	err        bool
+}{
+	{[]string{"gtk+-3.0"}, []string{}, []string{"gtk+-3.0"}, false},
+	{[]string{"--static", "libpng", "zlib"}, []string{"--static"}, []string{"libpng", "zlib"}, false},
+	{[]string{"--static", "--", "libpng"}, []string{"--static"}, []string{"libpng"}, false},
+	{[]string{"--", "-evil"}, nil, nil, true},
+}
+
+func TestSplitPkgConfig(t *testing.T) {
+	for _, tt := range splitPkgConfigTests {
+		opts, pkgs, err := splitPkgConfig(tt.args)
+		if tt.err {
+			if err == nil {
+				t.Errorf("splitPkgConfig(%q): expected error", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitPkgConfig(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts, tt.opts) || !reflect.DeepEqual(pkgs, tt.pkgs) {
+			t.Errorf("splitPkgConfig(%q): expected %q %q, got %q %q", tt.args, tt.opts, tt.pkgs, opts, pkgs)
+		}
+	}
+}
+
+var splitPkgConfigOutputTests = []struct {
+	out  string
+	want []string
+	err  bool
+}{
+	{"", nil, false},
+	{"-I/usr/include/libpng16 \n", []string{"-I/usr/include/libpng16"}, false},
+	{"-lpng16  -lz\n", []string{"-lpng16", "-lz"}, false},
+	{`-I/opt/my\ lib/include -DX="a b"`, []string{"-I/opt/my lib/include", "-DX=a b"}, false},
+	{`-I'/opt/x y'`, []string{"-I/opt/x y"}, false},
+	{`-DX="unterminated`, nil, true},
+}
+
+func TestSplitPkgConfigOutput(t *testing.T) {
+	for _, tt := range splitPkgConfigOutputTests {
+		got, err := splitPkgConfigOutput([]byte(tt.out))
+		if tt.err {
+			if err == nil {
+				t.Errorf("splitPkgConfigOutput(%q): expected error", tt.out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitPkgConfigOutput(%q): %v", tt.out, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitPkgConfigOutput(%q): expected %q, got %q", tt.out, tt.want, got)
+		}
+	}
+}
+
+func TestInsertFlags(t *testing.T) {
+	args := []string{"-objdir", "obj", "--", "-I", "src", "a.go"}
+	got := insertFlags(args, []string{"-I/usr/include/x"})
+	want := []string{"-objdir", "obj", "--", "-I/usr/include/x", "-I", "src", "a.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("insertFlags: expected %q, got %q", want, got)
+	}
+	if args[3] != "-I" {
+		t.Errorf("insertFlags: modified its argument: %q", args)
+	}
+}
@@ -0,0 +1,105 @@
+package build
+
+// printing of commands for the -n and -x flags
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// printer writes tool invocations as a shell script which can be
+// replayed to reproduce the build.
+type printer struct {
+	sync.Mutex
+	w       io.Writer
+	workdir string
+	header  bool // has the WORK= line been written
+}
+
+// printf writes a line to the script, prefixed by the location of the
+// work directory if this is the first line written.
+func (p *printer) printf(format string, args ...interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.header {
+		fmt.Fprintf(p.w, "WORK=%s\n", shellquote(p.workdir))
+		p.header = true
+	}
+	fmt.Fprintf(p.w, format, args...)
+}
+
+// printcmd writes cmd, its working directory, and any environment
+// variables that differ from our own, to the script.
+func (p *printer) printcmd(cmd *exec.Cmd) {
+	var env []string
+	if cmd.Env != nil {
+		inherited := make(map[string]bool)
+		for _, e := range os.Environ() {
+			inherited[e] = true
+		}
+		for _, e := range cmd.Env {
+			if !inherited[e] {
+				env = append(env, p.quote(e))
+			}
+		}
+	}
+	var args []string
+	for _, arg := range cmd.Args {
+		args = append(args, p.quote(arg))
+	}
+	line := strings.Join(append(env, args...), " ")
+	if cmd.Dir != "" {
+		p.printf("cd %s\n%s\n", p.quote(cmd.Dir), line)
+		return
+	}
+	p.printf("%s\n", line)
+}
+
+// shorten replaces references to the work directory in s with $WORK.
+func (p *printer) shorten(s string) string {
+	if p.workdir == "" {
+		return s
+	}
+	return strings.Replace(s, p.workdir, "$WORK", -1)
+}
+
+// quote shortens and quotes s for use in the script. Values which
+// refer to the work directory are double quoted so $WORK is expanded.
+func (p *printer) quote(s string) string {
+	short := p.shorten(s)
+	if short == s {
+		return shellquote(s)
+	}
+	rest := strings.Replace(short, "$WORK", "", -1)
+	if strings.ContainsAny(rest, "$\"\\`") {
+		// too hard to quote safely, use the long form.
+		return shellquote(s)
+	}
+	if strings.IndexFunc(rest, unsafeRune) >= 0 {
+		return `"` + short + `"`
+	}
+	return short
+}
+
+// shellquote quotes s so it is interpreted literally by the shell.
+func shellquote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, unsafeRune) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func unsafeRune(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("+-_./:=,@%", r)
+}
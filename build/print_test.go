@@ -0,0 +1,42 @@
+package build
+
+import "testing"
+
+var shellquoteTests = []struct {
+	in, want string
+}{
+	{"", "''"},
+	{"6g", "6g"},
+	{"-I", "-I"},
+	{"/usr/bin/gcc", "/usr/bin/gcc"},
+	{"GOOS=linux", "GOOS=linux"},
+	{"hello world", "'hello world'"},
+	{"it's", `'it'\''s'`},
+	{"$HOME", "'$HOME'"},
+}
+
+func TestShellquote(t *testing.T) {
+	for _, tt := range shellquoteTests {
+		if got := shellquote(tt.in); got != tt.want {
+			t.Errorf("shellquote(%q): expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+var printerQuoteTests = []struct {
+	in, want string
+}{
+	{"/tmp/gogo123/a/_obj", "$WORK/a/_obj"},
+	{"/tmp/gogo123/a b/_obj", `"$WORK/a b/_obj"`},
+	{"/tmp/gogo123/$x", `'/tmp/gogo123/$x'`},
+	{"/tmp/other", "/tmp/other"},
+}
+
+func TestPrinterQuote(t *testing.T) {
+	p := printer{workdir: "/tmp/gogo123"}
+	for _, tt := range printerQuoteTests {
+		if got := p.quote(tt.in); got != tt.want {
+			t.Errorf("quote(%q): expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
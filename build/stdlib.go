@@ -0,0 +1,90 @@
+package build
+
+// Go 1.20 and later no longer install the archives of the standard
+// library in $GOROOT/pkg; the go command builds them on demand into
+// its cache. When they are missing, the archives are found with
+// go list -export and linked into the work directory, which then
+// takes the place of $GOROOT/pkg in the search path.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stdlibCache records the result of linking the standard library
+// into each stdlib directory of a Context.
+type stdlibCache struct {
+	sync.Mutex
+	m map[string]error
+}
+
+// stdlibInstalled reports whether the archives of the standard
+// library are installed in $GOROOT/pkg, as they are before Go 1.20.
+func (ctx *Context) stdlibInstalled() bool {
+	if !modernTools(ctx.goroot, ctx.goos, ctx.goarch) {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(ctx.goroot, "pkg", ctx.goos+"_"+ctx.goarch+ctx.suffix()))
+	return err == nil
+}
+
+// installStdlib makes the archives of the standard library available
+// in ctx.stdlib(), if $GOROOT does not provide them. Only the first
+// call for each instrumentation mode does any work.
+func (ctx *Context) installStdlib() error {
+	if ctx.DryRun || ctx.stdlibInstalled() {
+		return nil
+	}
+	dir := ctx.stdlib()
+	ctx.stdlibs.Lock()
+	defer ctx.stdlibs.Unlock()
+	if err, ok := ctx.stdlibs.m[dir]; ok {
+		return err
+	}
+	if ctx.stdlibs.m == nil {
+		ctx.stdlibs.m = make(map[string]error)
+	}
+	err := ctx.linkStdlib(dir)
+	ctx.stdlibs.m[dir] = err
+	return err
+}
+
+// linkStdlib asks the go command of $GOROOT for the archives of the
+// standard library, building them if needed, and links each into dir
+// as dir/<importpath>.a.
+func (ctx *Context) linkStdlib(dir string) error {
+	args := []string{"list", "-export", "-deps", "-f", "{{if .Export}}{{.ImportPath}} {{.Export}}{{end}}"}
+	if ctx.instrument != "" {
+		args = append(args, "-"+ctx.instrument)
+	}
+	args = append(args, "std")
+	cgo := "0"
+	if ctx.cgoEnabled {
+		cgo = "1"
+	}
+	env := []string{"GOROOT=" + ctx.goroot, "GOOS=" + ctx.goos, "GOARCH=" + ctx.goarch, "CGO_ENABLED=" + cgo, "CC=" + ctx.CC, "GOFLAGS=", "GOTOOLCHAIN=local"}
+	out, err := ctx.runOut(filepath.Join(ctx.goroot, "src"), env, filepath.Join(ctx.goroot, "bin", "go"), args...)
+	if err != nil {
+		return fmt.Errorf("could not build the standard library: %v", err)
+	}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		afile := filepath.Join(dir, filepath.FromSlash(fields[0]+".a"))
+		if err := os.MkdirAll(filepath.Dir(afile), 0777); err != nil {
+			return err
+		}
+		if err := os.Symlink(fields[1], afile); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
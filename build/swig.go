@@ -0,0 +1,90 @@
+package build
+
+// swig support
+
+import (
+	"go/build"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davecheney/gogo/log"
+)
+
+// Swig returns a Future representing the result of running swig on
+// the interface file swigfile. swig generates a Go file, which must
+// be processed by cgo, and a C, or if cxx is set, a C++ wrapper.
+// The names of the generated files are returned by swigOutputs.
+// swig is invoked once dep has succeeded.
+func Swig(ctx *Context, pkg *build.Package, dep Future, swigfile string, cxx bool) Future {
+	t := &swigTarget{
+		target:   newTarget(ctx, pkg),
+		dep:      dep,
+		swigfile: swigfile,
+		cxx:      cxx,
+	}
+	go t.execute()
+	return t
+}
+
+// swigTarget implements a Future that represents invoking swig.
+type swigTarget struct {
+	target
+	dep      Future
+	swigfile string
+	cxx      bool
+}
+
+func (t *swigTarget) execute() {
+	if err := t.WaitDeps(t.dep); err != nil {
+		t.err <- err
+		return
+	}
+	log.Debugf("swig %q: %s", t.ImportPath, t.swigfile)
+	t.err <- t.build()
+}
+
+func (t *swigTarget) build() error {
+	t0 := time.Now()
+	objdir := objdir(t.Context, t.Package)
+	if err := t.Mkdir(objdir); err != nil {
+		return err
+	}
+	_, wrapper := swigOutputs(objdir, t.swigfile, t.cxx)
+	args := []string{"-go", "-cgo", "-intgosize", intgosize(t.goarch)}
+	if _, ok := t.Toolchain.(*gccgoToolchain); ok {
+		args = append(args, "-gccgo")
+	}
+	if t.cxx {
+		args = append(args, "-c++")
+	}
+	args = append(args, "-module", swigModule(t.swigfile), "-outdir", objdir, "-o", wrapper, t.swigfile)
+	err := t.Swig(t.Srcdir(), args)
+	t.Record("swig", time.Since(t0))
+	return t.Report(t.Package, "swig", err)
+}
+
+// swigModule returns the name of the swig module defined by swigfile.
+func swigModule(swigfile string) string {
+	return strings.TrimSuffix(swigfile, filepath.Ext(swigfile))
+}
+
+// swigOutputs returns the names of the Go file and wrapper which swig
+// generates in objdir from swigfile.
+func swigOutputs(objdir, swigfile string, cxx bool) (gofile, wrapper string) {
+	module := swigModule(swigfile)
+	gofile = filepath.Join(objdir, module+".go")
+	if cxx {
+		return gofile, filepath.Join(objdir, module+"_wrap.cxx")
+	}
+	return gofile, filepath.Join(objdir, module+"_wrap.c")
+}
+
+// intgosize returns the size, in bits, of the Go int type on goarch.
+func intgosize(goarch string) string {
+	switch goarch {
+	case "amd64", "arm64", "ppc64", "ppc64le", "mips64", "mips64le", "s390x", "riscv64", "loong64":
+		return "64"
+	}
+	return "32"
+}
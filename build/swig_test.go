@@ -0,0 +1,21 @@
+package build
+
+import "testing"
+
+var swigOutputsTests = []struct {
+	swigfile        string
+	cxx             bool
+	gofile, wrapper string
+}{
+	{"add.swig", false, "/obj/add.go", "/obj/add_wrap.c"},
+	{"mul.swigcxx", true, "/obj/mul.go", "/obj/mul_wrap.cxx"},
+}
+
+func TestSwigOutputs(t *testing.T) {
+	for _, tt := range swigOutputsTests {
+		gofile, wrapper := swigOutputs("/obj", tt.swigfile, tt.cxx)
+		if gofile != tt.gofile || wrapper != tt.wrapper {
+			t.Errorf("swigOutputs(%q, %v): expected %q %q, got %q %q", tt.swigfile, tt.cxx, tt.gofile, tt.wrapper, gofile, wrapper)
+		}
+	}
+}
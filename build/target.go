@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
 )
 
 // target implements a Future
@@ -23,7 +24,7 @@ func (t *target) Result() error {
 }
 
 func (t *target) Srcdir() string {
-	return filepath.Join(t.SrcRoot, t.ImportPath)
+	return t.Dir
 }
 
 func newTarget(ctx *Context, pkg *build.Package) target {
@@ -42,11 +43,9 @@ type gcTarget struct {
 }
 
 func (t *gcTarget) execute() {
-	for _, dep := range t.deps {
-		if err := dep.Result(); err != nil {
-			t.err <- err
-			return
-		}
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
 	}
 	log.Debugf("gc %q: %s", t.ImportPath, t.gofiles)
 	t.err <- t.build()
@@ -59,9 +58,28 @@ func (t *gcTarget) build() error {
 	if err := t.Mkdir(objdir(t.Context, t.Package)); err != nil {
 		return err
 	}
-	err := t.Gc(t.ImportPath, t.Srcdir(), t.Objfile(), t.gofiles)
+	if err := t.installStdlib(); err != nil {
+		return t.Report(t.Package, "stdlib", &Error{Err: err})
+	}
+	var embedcfg string
+	if len(t.EmbedPatterns) > 0 {
+		embedcfg = filepath.Join(objdir(t.Context, t.Package), "embedcfg")
+		data, err := embedConfig(t.Srcdir(), t.EmbedPatterns)
+		if err != nil {
+			return t.Report(t.Package, "embed", &Error{Err: err})
+		}
+		if err := t.WriteFile(embedcfg, data); err != nil {
+			return err
+		}
+	}
+	importpath := t.ImportPath
+	if t.Name == "main" {
+		// the linker finds main.main by this name.
+		importpath = "main"
+	}
+	err := t.Gc(importpath, t.Srcdir(), t.Objfile(), embedcfg, project.ImportMap(t.Package), t.gofiles)
 	t.Record("gc", time.Since(t0))
-	return err
+	return t.Report(t.Package, "gc", err)
 }
 
 // ccTarget implements a Future that represents compiling a .c file.
@@ -77,36 +95,49 @@ func (t *ccTarget) Objfile() string {
 
 func (t *ccTarget) execute() {
 	t0 := time.Now()
-	if err := t.dep.Result(); err != nil {
+	if err := t.WaitDeps(t.dep); err != nil {
 		t.err <- err
 		return
 	}
 	log.Debugf("cc %q: %s", t.Package.ImportPath, t.cfile)
 	err := t.Cc(t.Srcdir(), objdir(t.Context, t.Package), t.Objfile(), filepath.Join(objdir(t.Context, t.Package), t.cfile))
 	t.Record("cc", time.Since(t0))
-	t.err <- err
+	t.err <- t.Report(t.Package, "cc", err)
 }
 
-// ccTarget implements a gogo.Future that represents the result of
-// invoking the system gcc compiler.
+// gccTarget implements a gogo.Future that represents the result of
+// invoking the system C, C++ or Fortran compiler.
 type gccTarget struct {
 	target
-	deps []Future
-	args []string
+	action string // gcc, g++, or gfortran
+	deps   []Future
+	flags  []flagsFuture
+	args   []string
 }
 
 func (t *gccTarget) execute() {
-	for _, dep := range t.deps {
-		if err := dep.Result(); err != nil {
-			t.err <- err
-			return
-		}
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
+	}
+	flags, err := waitFlags(t.flags)
+	if err != nil {
+		t.err <- err
+		return
 	}
 	t0 := time.Now()
-	log.Debugf("gcc %q: %s", t.Package.ImportPath, t.args)
-	err := t.Gcc(t.Srcdir(), t.args)
-	t.Record("gcc", time.Since(t0))
-	t.err <- err
+	args := append(append([]string{}, t.args...), flags...)
+	log.Debugf("%s %q: %s", t.action, t.Package.ImportPath, args)
+	switch t.action {
+	case "g++":
+		err = t.Cxx(t.Srcdir(), args)
+	case "gfortran":
+		err = t.Fortran(t.Srcdir(), args)
+	default:
+		err = t.Gcc(t.Srcdir(), args)
+	}
+	t.Record(t.action, time.Since(t0))
+	t.err <- t.Report(t.Package, t.action, err)
 }
 
 // asmTarget implements a Future that represents assembling a .s file.
@@ -116,6 +147,10 @@ type asmTarget struct {
 }
 
 func (t *asmTarget) execute() {
+	if err := t.WaitDeps(); err != nil {
+		t.err <- err
+		return
+	}
 	log.Debugf("as %q: %s", t.ImportPath, t.sfile)
 	t.err <- t.build()
 }
@@ -131,35 +166,38 @@ func (t *asmTarget) build() error {
 	}
 	err := t.Asm(t.Srcdir(), t.Objfile(), t.sfile)
 	t.Record("asm", time.Since(t0))
-	return err
+	return t.Report(t.Package, "asm", err)
 }
 
 // cgoTarget implements a Future that represents invoking the cgo command.
 type cgoTarget struct {
 	target
-	deps []Future
-	args []string
+	deps  []Future
+	flags []flagsFuture
+	args  []string
 }
 
 func (t *cgoTarget) execute() {
-	for _, dep := range t.deps {
-		if err := dep.Result(); err != nil {
-			t.err <- err
-			return
-		}
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
 	}
 	log.Debugf("cgo %q: %s", t.ImportPath, t.args)
 	t.err <- t.build()
 }
 
 func (t *cgoTarget) build() error {
+	flags, err := waitFlags(t.flags)
+	if err != nil {
+		return err
+	}
 	t0 := time.Now()
 	if err := t.Mkdir(objdir(t.Context, t.Package)); err != nil {
 		return err
 	}
-	err := t.Cgo(t.Srcdir(), t.args)
+	err = t.Cgo(t.Srcdir(), insertFlags(t.args, flags))
 	t.Record("cgo", time.Since(t0))
-	return err
+	return t.Report(t.Package, "cgo", err)
 }
 
 // packTarget implements a Future that represents packing Go object files into a .a archive.
@@ -178,6 +216,10 @@ func (t *packTarget) execute() {
 		// collect successful objfiles for packing
 		t.objfiles = append(t.objfiles, dep.Objfile())
 	}
+	if err := t.WaitDeps(); err != nil {
+		t.err <- err
+		return
+	}
 	log.Infof("pack %q: %s", t.ImportPath, t.objfiles)
 	t.err <- t.build()
 }
@@ -195,7 +237,7 @@ func (t *packTarget) build() error {
 	}
 	err := t.Pack(afile, t.objfiles...)
 	t.Record("pack", time.Since(t0))
-	return err
+	return t.Report(t.Package, "pack", err)
 }
 
 // ldTarget implements a Future that represents
@@ -206,7 +248,7 @@ type ldTarget struct {
 }
 
 func (t *ldTarget) execute() {
-	if err := t.afile.Result(); err != nil {
+	if err := t.WaitDeps(t.afile); err != nil {
 		t.err <- err
 		return
 	}
@@ -220,7 +262,10 @@ func (t *ldTarget) build() error {
 	if err := t.Mkdir(bindir); err != nil {
 		return err
 	}
-	err := t.Ld(filepath.Join(bindir, filepath.Base(t.ImportPath)), t.afile.pkgfile())
+	if err := t.installStdlib(); err != nil {
+		return t.Report(t.Package, "stdlib", &Error{Err: err})
+	}
+	err := t.Ld(Binfile(t.Context, t.Package), t.afile.pkgfile())
 	t.Record("ld", time.Since(t0))
-	return err
+	return t.Report(t.Package, "ld", err)
 }
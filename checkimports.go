@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
+)
+
+func init() {
+	registerCommand("check-imports", CheckImportsCmd)
+}
+
+var CheckImportsCmd = &Command{
+	Run: func(proj *project.Project, args []string) error {
+		if len(proj.Rules()) == 0 {
+			log.Warnf("no import rules in %s/.gogo/rules", proj.Root())
+			return nil
+		}
+		// report every violation, rather than failing to resolve
+		// the first package which has one.
+		proj.Setenv("GOGO_CHECKIMPORTS", "0")
+		pkgs, err := resolvePackages(proj, args)
+		if err != nil {
+			return err
+		}
+		var n int
+		for _, pkg := range pkgs {
+			for _, v := range proj.CheckImports(pkg) {
+				fmt.Println(v)
+				n++
+			}
+		}
+		if n > 0 {
+			log.Errorf("%d import rule violations", n)
+			return exitStatus(1)
+		}
+		return nil
+	},
+	AddFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&A, "a", false, "check all packages in this project")
+	},
+}
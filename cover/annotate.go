@@ -0,0 +1,261 @@
+// Package gogo/cover provides functions for instrumenting Go source
+// with coverage counters, and for reporting on the resulting profiles.
+package cover
+
+// adapted from $GOROOT/src/cmd/cover/cover.go
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+)
+
+// Coverage modes.
+const (
+	Set    = "set"
+	Count  = "count"
+	Atomic = "atomic"
+)
+
+const atomicPackageName = "_cover_atomic_"
+
+// Annotate writes to w a copy of the Go source src, named filename,
+// with a coverage counter added to each basic block. The counters are
+// stored in a package level variable named varName.
+func Annotate(w io.Writer, src []byte, filename, varName, mode string) error {
+	switch mode {
+	case Set, Count, Atomic:
+	default:
+		return fmt.Errorf("unknown coverage mode %q", mode)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	a := &annotator{
+		fset:    fset,
+		varName: varName,
+		mode:    mode,
+	}
+	if mode == Atomic {
+		a.insert(a.offset(f.Name.End()), fmt.Sprintf("; import %s %q", atomicPackageName, "sync/atomic"))
+	}
+	ast.Walk(a, f)
+	if _, err := w.Write(a.apply(src)); err != nil {
+		return err
+	}
+	return a.writeVar(w)
+}
+
+// block records the position of a basic block.
+type block struct {
+	start, end token.Position
+	numStmt    int
+}
+
+type insertion struct {
+	offset int
+	text   string
+}
+
+type annotator struct {
+	fset       *token.FileSet
+	varName    string
+	mode       string
+	blocks     []block
+	insertions []insertion
+}
+
+func (a *annotator) insert(offset int, text string) {
+	a.insertions = append(a.insertions, insertion{offset, text})
+}
+
+// apply returns src with all the recorded insertions applied.
+func (a *annotator) apply(src []byte) []byte {
+	sort.Stable(byOffset(a.insertions))
+	var buf bytes.Buffer
+	last := 0
+	for _, ins := range a.insertions {
+		buf.Write(src[last:ins.offset])
+		buf.WriteString(ins.text)
+		last = ins.offset
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
+
+type byOffset []insertion
+
+func (x byOffset) Len() int           { return len(x) }
+func (x byOffset) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byOffset) Less(i, j int) bool { return x[i].offset < x[j].offset }
+
+// Visit implements ast.Visitor.
+func (a *annotator) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		a.addCounters(n.Lbrace+1, n.Rbrace+1, n.List, true)
+	case *ast.SwitchStmt:
+		// The body of a switch or select is a list of clauses, which
+		// may be empty; only the clauses themselves are tagged.
+		if n.Init != nil {
+			ast.Walk(a, n.Init)
+		}
+		if n.Tag != nil {
+			ast.Walk(a, n.Tag)
+		}
+		a.walkClauses(n.Body)
+		return nil
+	case *ast.TypeSwitchStmt:
+		if n.Init != nil {
+			ast.Walk(a, n.Init)
+		}
+		ast.Walk(a, n.Assign)
+		a.walkClauses(n.Body)
+		return nil
+	case *ast.SelectStmt:
+		a.walkClauses(n.Body)
+		return nil
+	case *ast.CaseClause:
+		a.addCounters(n.Colon+1, n.End(), n.Body, false)
+	case *ast.CommClause:
+		a.addCounters(n.Colon+1, n.End(), n.Body, false)
+	}
+	return a
+}
+
+// walkClauses walks the clauses of the body of a switch or select.
+func (a *annotator) walkClauses(body *ast.BlockStmt) {
+	for _, clause := range body.List {
+		ast.Walk(a, clause)
+	}
+}
+
+// addCounters inserts a counter at the start of each basic block in list.
+func (a *annotator) addCounters(pos, blockEnd token.Pos, list []ast.Stmt, extendToClosingBrace bool) {
+	if len(list) == 0 {
+		a.insert(a.offset(pos), a.newCounter(pos, blockEnd, 0))
+		return
+	}
+	for {
+		// Find first statement that affects flow of control.
+		var last int
+		end := blockEnd
+		for last = 0; last < len(list); last++ {
+			end = a.statementBoundary(list[last])
+			if endsBasicSourceBlock(list[last]) {
+				extendToClosingBrace = false
+				last++
+				break
+			}
+		}
+		if extendToClosingBrace {
+			end = blockEnd
+		}
+		if pos != end {
+			a.insert(a.offset(pos), a.newCounter(pos, end, last))
+		}
+		list = list[last:]
+		if len(list) == 0 {
+			break
+		}
+		pos = list[0].Pos()
+	}
+}
+
+func (a *annotator) offset(pos token.Pos) int { return a.fset.Position(pos).Offset }
+
+// newCounter records a block from start to end, and returns the
+// statement which increments its counter.
+func (a *annotator) newCounter(start, end token.Pos, numStmt int) string {
+	n := len(a.blocks)
+	a.blocks = append(a.blocks, block{a.fset.Position(start), a.fset.Position(end), numStmt})
+	counter := fmt.Sprintf("%s.Count[%d]", a.varName, n)
+	switch a.mode {
+	case Set:
+		return counter + " = 1;"
+	case Count:
+		return counter + "++;"
+	default:
+		return fmt.Sprintf("%s.AddUint32(&%s, 1);", atomicPackageName, counter)
+	}
+}
+
+// statementBoundary finds the location in s that terminates the
+// current basic block in the source.
+func (a *annotator) statementBoundary(s ast.Stmt) token.Pos {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		// Treat blocks like basic blocks to avoid overlapping counters.
+		return s.Lbrace
+	case *ast.IfStmt:
+		return s.Body.Lbrace
+	case *ast.ForStmt:
+		return s.Body.Lbrace
+	case *ast.LabeledStmt:
+		return a.statementBoundary(s.Stmt)
+	case *ast.RangeStmt:
+		return s.Body.Lbrace
+	case *ast.SwitchStmt:
+		return s.Body.Lbrace
+	case *ast.SelectStmt:
+		return s.Body.Lbrace
+	case *ast.TypeSwitchStmt:
+		return s.Body.Lbrace
+	}
+	return s.End()
+}
+
+// endsBasicSourceBlock reports whether s changes the flow of control.
+func endsBasicSourceBlock(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.BlockStmt, *ast.BranchStmt, *ast.ForStmt, *ast.IfStmt,
+		*ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt,
+		*ast.ReturnStmt, *ast.GoStmt, *ast.DeferStmt:
+		return true
+	case *ast.LabeledStmt:
+		return endsBasicSourceBlock(s.Stmt)
+	case *ast.ExprStmt:
+		// Calls to panic change the flow.
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && len(call.Args) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeVar writes the declaration of the counter variable, and the
+// positions of the blocks it counts.
+func (a *annotator) writeVar(w io.Writer) error {
+	n := len(a.blocks)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\nvar %s = struct {\n", a.varName)
+	fmt.Fprintf(&buf, "\tCount   [%d]uint32\n", n)
+	fmt.Fprintf(&buf, "\tPos     [3 * %d]uint32\n", n)
+	fmt.Fprintf(&buf, "\tNumStmt [%d]uint16\n", n)
+	fmt.Fprintf(&buf, "} {\n")
+	fmt.Fprintf(&buf, "\tPos: [3 * %d]uint32{\n", n)
+	for i, b := range a.blocks {
+		fmt.Fprintf(&buf, "\t\t%d, %d, %#x, // [%d]\n",
+			b.start.Line, b.end.Line, (b.end.Column&0xFFFF)<<16|(b.start.Column&0xFFFF), i)
+	}
+	fmt.Fprintf(&buf, "\t},\n")
+	fmt.Fprintf(&buf, "\tNumStmt: [%d]uint16{\n", n)
+	for i, b := range a.blocks {
+		fmt.Fprintf(&buf, "\t\t%d, // %d\n", b.numStmt, i)
+	}
+	fmt.Fprintf(&buf, "\t},\n")
+	fmt.Fprintf(&buf, "}\n")
+	if a.mode == Atomic {
+		fmt.Fprintf(&buf, "var _ = %s.AddUint32\n", atomicPackageName)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
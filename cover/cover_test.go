@@ -0,0 +1,159 @@
+package cover
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const annotateSrc = `package p
+
+func f(x int) int {
+	if x > 0 {
+		return 1
+	}
+	switch x {
+	case -1:
+		x++
+		fallthrough
+	case -2:
+	default:
+		panic("x")
+	}
+	for i := 0; i < x; i++ {
+	}
+	return 0
+}
+`
+
+func TestAnnotate(t *testing.T) {
+	for _, mode := range []string{Set, Count, Atomic} {
+		var buf bytes.Buffer
+		if err := Annotate(&buf, []byte(annotateSrc), "p.go", "GoCover_0", mode); err != nil {
+			t.Fatalf("Annotate(%s): %v", mode, err)
+		}
+		out := buf.String()
+		if _, err := parser.ParseFile(token.NewFileSet(), "p.go", out, 0); err != nil {
+			t.Fatalf("Annotate(%s): output does not parse: %v\n%s", mode, err, out)
+		}
+		if !strings.Contains(out, "var GoCover_0 = struct") {
+			t.Fatalf("Annotate(%s): counter variable not declared\n%s", mode, out)
+		}
+		if n := strings.Count(out, "GoCover_0.Count["); n != 9 {
+			t.Errorf("Annotate(%s): expected 9 counters, got %d\n%s", mode, n, out)
+		}
+	}
+}
+
+var annotateEmptyTests = []struct {
+	stmt     string
+	counters int
+}{
+	{"switch x {}", 1},
+	{"switch y := x; y {}", 1},
+	{"switch v := interface{}(x).(type) {}", 1},
+	{"select {}", 1},
+	{"switch x { case 1: }", 2},
+	{"select { default: }", 2},
+}
+
+// TestAnnotateEmpty checks that the empty bodies of switch and select
+// statements, which may only hold clauses, are not given counters.
+func TestAnnotateEmpty(t *testing.T) {
+	for _, tt := range annotateEmptyTests {
+		src := "package p\n\nfunc f(x int) {\n\t" + tt.stmt + "\n}\n"
+		var buf bytes.Buffer
+		if err := Annotate(&buf, []byte(src), "p.go", "GoCover_0", Set); err != nil {
+			t.Fatalf("Annotate(%q): %v", tt.stmt, err)
+		}
+		out := buf.String()
+		if _, err := parser.ParseFile(token.NewFileSet(), "p.go", out, 0); err != nil {
+			t.Errorf("Annotate(%q): output does not parse: %v\n%s", tt.stmt, err, out)
+			continue
+		}
+		if n := strings.Count(out, "GoCover_0.Count["); n != tt.counters {
+			t.Errorf("Annotate(%q): expected %d counters, got %d\n%s", tt.stmt, tt.counters, n, out)
+		}
+	}
+}
+
+func TestAnnotateUnknownMode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Annotate(&buf, []byte(annotateSrc), "p.go", "GoCover_0", "sometimes"); err == nil {
+		t.Fatalf("Annotate: expected error for unknown mode")
+	}
+}
+
+const profileA = `mode: set
+a/a.go:3.20,5.2 1 1
+a/a.go:5.2,7.2 2 0
+`
+
+const profileB = `mode: set
+a/a.go:5.2,7.2 2 1
+b/b.go:1.1,2.2 1 0
+`
+
+func TestMerge(t *testing.T) {
+	a, err := ParseProfiles(strings.NewReader(profileA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseProfiles(strings.NewReader(profileB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := Merge(append(a, b...))
+	want := []*Profile{
+		{FileName: "a/a.go", Mode: Set, Blocks: []ProfileBlock{{3, 20, 5, 2, 1, 1}, {5, 2, 7, 2, 2, 1}}},
+		{FileName: "b/b.go", Mode: Set, Blocks: []ProfileBlock{{1, 1, 2, 2, 1, 0}}},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Fatalf("Merge: expected %v, got %v", want, merged)
+	}
+	var buf bytes.Buffer
+	if err := WriteProfile(&buf, merged); err != nil {
+		t.Fatal(err)
+	}
+	roundtrip, err := ParseProfiles(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roundtrip, want) {
+		t.Fatalf("ParseProfiles(WriteProfile()): expected %v, got %v", want, roundtrip)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	profiles, err := ParseProfiles(strings.NewReader(profileA + "b/b.go:1.1,2.2 1 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteText(&buf, profiles); err != nil {
+		t.Fatal(err)
+	}
+	want := "a/a.go\t33.3%\nb/b.go\t100.0%\ntotal:\t50.0%\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteText: expected %q, got %q", want, got)
+	}
+}
+
+func TestWriteCobertura(t *testing.T) {
+	profiles, err := ParseProfiles(strings.NewReader(profileA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCobertura(&buf, profiles, "/project/src"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`lines-valid="5"`, `lines-covered="3"`, `<package name="a"`, `<line number="6" hits="0">`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteCobertura: output missing %q\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cover
+
+// coverage profiles
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile represents the coverage profile of a single file.
+type Profile struct {
+	FileName string
+	Mode     string
+	Blocks   []ProfileBlock
+}
+
+// ProfileBlock represents a single block of a coverage profile.
+type ProfileBlock struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+	NumStmt, Count      int
+}
+
+var lineRe = regexp.MustCompile(`^(.+):([0-9]+)\.([0-9]+),([0-9]+)\.([0-9]+) ([0-9]+) ([0-9]+)$`)
+
+// ParseProfiles parses a coverage profile, as written by a test
+// binary run with -test.coverprofile, into Profiles.
+func ParseProfiles(r io.Reader) ([]*Profile, error) {
+	files := make(map[string]*Profile)
+	s := bufio.NewScanner(r)
+	mode := ""
+	for s.Scan() {
+		line := s.Text()
+		if mode == "" {
+			const p = "mode: "
+			if !strings.HasPrefix(line, p) || line == p {
+				return nil, fmt.Errorf("bad mode line: %v", line)
+			}
+			mode = line[len(p):]
+			continue
+		}
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %q doesn't match expected format: %v", line, lineRe)
+		}
+		fn := m[1]
+		p := files[fn]
+		if p == nil {
+			p = &Profile{FileName: fn, Mode: mode}
+			files[fn] = p
+		}
+		p.Blocks = append(p.Blocks, ProfileBlock{
+			StartLine: atoi(m[2]),
+			StartCol:  atoi(m[3]),
+			EndLine:   atoi(m[4]),
+			EndCol:    atoi(m[5]),
+			NumStmt:   atoi(m[6]),
+			Count:     atoi(m[7]),
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	var profiles []*Profile
+	for _, p := range files {
+		profiles = append(profiles, p)
+	}
+	return Merge(profiles), nil
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+// Merge combines profiles, which may describe the same files, into a
+// single set of Profiles, sorted by file name. The counts of blocks
+// which appear more than once are summed, or in set mode, or'd.
+func Merge(profiles []*Profile) []*Profile {
+	files := make(map[string]*Profile)
+	blocks := make(map[string]map[ProfileBlock]int) // block, with zero count, to index in Blocks
+	for _, p := range profiles {
+		m := files[p.FileName]
+		if m == nil {
+			m = &Profile{FileName: p.FileName, Mode: p.Mode}
+			files[p.FileName] = m
+			blocks[p.FileName] = make(map[ProfileBlock]int)
+		}
+		for _, b := range p.Blocks {
+			count := b.Count
+			b.Count = 0
+			i, ok := blocks[p.FileName][b]
+			if !ok {
+				i = len(m.Blocks)
+				blocks[p.FileName][b] = i
+				m.Blocks = append(m.Blocks, b)
+			}
+			if m.Mode == Set {
+				if count > 0 {
+					m.Blocks[i].Count = 1
+				}
+			} else {
+				m.Blocks[i].Count += count
+			}
+		}
+	}
+	var merged []*Profile
+	for _, p := range files {
+		sort.Sort(blocksByStart(p.Blocks))
+		merged = append(merged, p)
+	}
+	sort.Sort(byFileName(merged))
+	return merged
+}
+
+type byFileName []*Profile
+
+func (p byFileName) Len() int           { return len(p) }
+func (p byFileName) Less(i, j int) bool { return p[i].FileName < p[j].FileName }
+func (p byFileName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type blocksByStart []ProfileBlock
+
+func (b blocksByStart) Len() int      { return len(b) }
+func (b blocksByStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b blocksByStart) Less(i, j int) bool {
+	bi, bj := b[i], b[j]
+	return bi.StartLine < bj.StartLine || bi.StartLine == bj.StartLine && bi.StartCol < bj.StartCol
+}
+
+// WriteProfile writes profiles to w in the format read by ParseProfiles.
+func WriteProfile(w io.Writer, profiles []*Profile) error {
+	mode := Set
+	if len(profiles) > 0 {
+		mode = profiles[0].Mode
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", mode)
+	for _, p := range profiles {
+		for _, b := range p.Blocks {
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Statements returns the number of statements in p, and the number
+// of those which were executed.
+func (p *Profile) Statements() (total, covered int) {
+	for _, b := range p.Blocks {
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	return total, covered
+}
+
+// percent returns covered as a percentage of total.
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
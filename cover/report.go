@@ -0,0 +1,248 @@
+package cover
+
+// coverage reports
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteText writes a summary of the statement coverage of each file
+// in profiles, and of profiles as a whole, to w.
+func WriteText(w io.Writer, profiles []*Profile) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+	var total, covered int
+	for _, p := range profiles {
+		t, c := p.Statements()
+		total += t
+		covered += c
+		fmt.Fprintf(tw, "%s\t%.1f%%\n", p.FileName, percent(c, t))
+	}
+	fmt.Fprintf(tw, "total:\t%.1f%%\n", percent(covered, total))
+	return tw.Flush()
+}
+
+// lineCoverage returns, for each line in p, whether the line was
+// covered (1), not covered (-1), or contains no statements (0).
+func lineCoverage(p *Profile) map[int]int {
+	lines := make(map[int]int)
+	for _, b := range p.Blocks {
+		if b.NumStmt == 0 {
+			continue
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			switch {
+			case b.Count > 0:
+				lines[l] = 1
+			case lines[l] == 0:
+				lines[l] = -1
+			}
+		}
+	}
+	return lines
+}
+
+// lineHits returns the highest count of any block which covers each line of p.
+func lineHits(p *Profile) map[int]int {
+	hits := make(map[int]int)
+	for _, b := range p.Blocks {
+		if b.NumStmt == 0 {
+			continue
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if h, ok := hits[l]; !ok || b.Count > h {
+				hits[l] = b.Count
+			}
+		}
+	}
+	return hits
+}
+
+type htmlFile struct {
+	Name    string
+	Percent float64
+	Lines   []htmlLine
+}
+
+type htmlLine struct {
+	Class string
+	Text  string
+}
+
+// WriteHTML writes an HTML page to w showing the source of each file
+// in profiles, highlighting the lines which were, or were not, covered.
+// source is used to read the contents of a file named in a Profile.
+func WriteHTML(w io.Writer, profiles []*Profile, source func(fileName string) ([]byte, error)) error {
+	var files []htmlFile
+	for _, p := range profiles {
+		src, err := source(p.FileName)
+		if err != nil {
+			return fmt.Errorf("can't read %q: %v", p.FileName, err)
+		}
+		cov := lineCoverage(p)
+		t, c := p.Statements()
+		f := htmlFile{Name: p.FileName, Percent: percent(c, t)}
+		for i, line := range strings.Split(string(bytes.TrimRight(src, "\n")), "\n") {
+			var class string
+			switch cov[i+1] {
+			case 1:
+				class = "cov"
+			case -1:
+				class = "uncov"
+			}
+			f.Lines = append(f.Lines, htmlLine{class, line})
+		}
+		files = append(files, f)
+	}
+	return htmlTmpl.Execute(w, files)
+}
+
+var htmlTmpl = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<title>gogo coverage</title>
+<style>
+body { background: black; color: rgb(80, 80, 80); font-family: Menlo, monospace; }
+pre { margin: 0; }
+.cov { color: rgb(44, 212, 149); }
+.uncov { color: rgb(192, 0, 0); }
+</style>
+</head>
+<body>
+<select onchange="show(this.value)">
+{{range $i, $f := .}}<option value="file{{$i}}">{{$f.Name}} ({{printf "%.1f" $f.Percent}}%)</option>
+{{end}}</select>
+{{range $i, $f := .}}<div class="file" id="file{{$i}}"{{if $i}} style="display: none"{{end}}>
+{{range $f.Lines}}<pre{{if .Class}} class="{{.Class}}"{{end}}>{{.Text}}</pre>
+{{end}}</div>
+{{end}}<script>
+function show(id) {
+	var files = document.getElementsByClassName("file");
+	for (var i = 0; i < files.length; i++) {
+		files[i].style.display = files[i].id == id ? "block" : "none";
+	}
+}
+</script>
+</body>
+</html>
+`))
+
+// Cobertura XML report types, see http://cobertura.sourceforge.net/xml/coverage-04.dtd
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      float64            `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// WriteCobertura writes a Cobertura XML report of profiles to w.
+// srcdir is the directory which the file names in profiles are relative to.
+func WriteCobertura(w io.Writer, profiles []*Profile, srcdir string) error {
+	cov := coberturaCoverage{
+		Version:   "gogo",
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Sources:   []string{srcdir},
+	}
+	pkgs := make(map[string]*coberturaPackage)
+	pkgLines := make(map[string][2]int) // valid, covered
+	var names []string
+	for _, p := range profiles {
+		dir := path.Dir(p.FileName)
+		pkg, ok := pkgs[dir]
+		if !ok {
+			pkg = &coberturaPackage{Name: dir}
+			pkgs[dir] = pkg
+			names = append(names, dir)
+		}
+		class := coberturaClass{
+			Name:     path.Base(p.FileName),
+			Filename: p.FileName,
+		}
+		hits := lineHits(p)
+		var numbers []int
+		for l := range hits {
+			numbers = append(numbers, l)
+		}
+		sort.Ints(numbers)
+		var covered int
+		for _, l := range numbers {
+			class.Lines = append(class.Lines, coberturaLine{l, hits[l]})
+			if hits[l] > 0 {
+				covered++
+			}
+		}
+		class.LineRate = rate(covered, len(numbers))
+		pkg.Classes = append(pkg.Classes, class)
+		n := pkgLines[dir]
+		pkgLines[dir] = [2]int{n[0] + len(numbers), n[1] + covered}
+		cov.LinesValid += len(numbers)
+		cov.LinesCovered += covered
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := pkgs[name]
+		n := pkgLines[name]
+		pkg.LineRate = rate(n[1], n[0])
+		cov.Packages = append(cov.Packages, *pkg)
+	}
+	cov.LineRate = rate(cov.LinesCovered, cov.LinesValid)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(cov); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// rate returns covered as a fraction of total.
+func rate(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(covered) / float64(total)
+}
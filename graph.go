@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	gobuild "go/build"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/davecheney/gogo/project"
+)
+
+func init() {
+	registerCommand("graph", GraphCmd)
+}
+
+var (
+	// graph flags
+
+	// should the imports of tests be included ?
+	GraphTest bool
+
+	// should packages from the standard library be included ?
+	GraphStd bool
+
+	// restrict the graph to the packages reachable from, or leading
+	// to, these packages.
+	GraphFrom, GraphTo string
+)
+
+// graphNode is a package in the import graph.
+type graphNode struct {
+	ImportPath string
+	Std        bool `json:",omitempty"`
+}
+
+// graphEdge is an import of To by From. Test is set if only the tests
+// of From import To.
+type graphEdge struct {
+	From, To string
+	Test     bool `json:",omitempty"`
+}
+
+// graph is the import graph of a set of packages.
+type graph struct {
+	Nodes []graphNode
+	Edges []graphEdge
+}
+
+// graphBuilder accumulates the nodes and edges of a graph.
+type graphBuilder struct {
+	proj  *project.Project
+	nodes map[string]graphNode
+	edges map[[2]string]graphEdge
+}
+
+// loadGraph returns the import graph of pkgs and the packages they
+// depend on. Packages are resolved in the same way as by build, so the
+// graph is that of the packages which would be compiled.
+func loadGraph(proj *project.Project, pkgs []*gobuild.Package) (*graph, error) {
+	b := &graphBuilder{
+		proj:  proj,
+		nodes: make(map[string]graphNode),
+		edges: make(map[[2]string]graphEdge),
+	}
+	for _, pkg := range pkgs {
+		if err := b.visit(pkg); err != nil {
+			return nil, err
+		}
+		if !GraphTest {
+			continue
+		}
+		for _, imports := range [][]string{pkg.TestImports, pkg.XTestImports} {
+			if err := b.addImports(pkg.ImportPath, imports, true); err != nil {
+				return nil, err
+			}
+		}
+		for _, pos := range []map[string][]token.Position{pkg.TestImportPos, pkg.XTestImportPos} {
+			b.addStd(pkg.ImportPath, pos, true)
+		}
+	}
+	return b.graph(), nil
+}
+
+// visit adds pkg, and the packages it imports, to the graph.
+func (b *graphBuilder) visit(pkg *gobuild.Package) error {
+	if _, ok := b.nodes[pkg.ImportPath]; ok {
+		return nil
+	}
+	b.nodes[pkg.ImportPath] = graphNode{ImportPath: pkg.ImportPath}
+	b.addStd(pkg.ImportPath, pkg.ImportPos, false)
+	return b.addImports(pkg.ImportPath, pkg.Imports, false)
+}
+
+func (b *graphBuilder) addImports(from string, imports []string, test bool) error {
+	for _, imp := range imports {
+		if imp == from {
+			// an external test importing the package under test.
+			continue
+		}
+		b.addEdge(from, imp, test)
+		pkg, err := b.proj.ResolvePackage(*goos, *goarch, imp).Result()
+		if err != nil {
+			return fmt.Errorf("failed to resolve package %q: %v", imp, err)
+		}
+		if err := b.visit(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addStd adds the imports from the standard library recorded in pos,
+// if they are included in the graph.
+func (b *graphBuilder) addStd(from string, pos map[string][]token.Position, test bool) {
+	if !GraphStd {
+		return
+	}
+	for imp := range pos {
+		if !project.IsStdlib(imp) {
+			continue
+		}
+		b.nodes[imp] = graphNode{ImportPath: imp, Std: true}
+		b.addEdge(from, imp, test)
+	}
+}
+
+// addEdge adds an import of to by from. An import by a package takes
+// precedence over the same import by its tests.
+func (b *graphBuilder) addEdge(from, to string, test bool) {
+	key := [2]string{from, to}
+	if e, ok := b.edges[key]; ok && !e.Test {
+		return
+	}
+	b.edges[key] = graphEdge{From: from, To: to, Test: test}
+}
+
+// graph returns the accumulated graph, sorted by import path.
+func (b *graphBuilder) graph() *graph {
+	g := new(graph)
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	for _, e := range b.edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Sort(nodesByPath(g.Nodes))
+	sort.Sort(edgesByPath(g.Edges))
+	return g
+}
+
+type nodesByPath []graphNode
+
+func (n nodesByPath) Len() int           { return len(n) }
+func (n nodesByPath) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n nodesByPath) Less(i, j int) bool { return n[i].ImportPath < n[j].ImportPath }
+
+type edgesByPath []graphEdge
+
+func (e edgesByPath) Len() int      { return len(e) }
+func (e edgesByPath) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e edgesByPath) Less(i, j int) bool {
+	if e[i].From != e[j].From {
+		return e[i].From < e[j].From
+	}
+	return e[i].To < e[j].To
+}
+
+// subgraph returns the part of g reachable from the package from, if
+// set, and leading to the package to, if set.
+func (g *graph) subgraph(from, to string) (*graph, error) {
+	keep := make(map[string]bool)
+	for _, n := range g.Nodes {
+		keep[n.ImportPath] = true
+	}
+	for _, path := range []string{from, to} {
+		if path != "" && !keep[path] {
+			return nil, fmt.Errorf("package %q is not in the graph", path)
+		}
+	}
+	for _, end := range []struct {
+		path    string
+		forward bool
+	}{
+		{from, true},
+		{to, false},
+	} {
+		if end.path == "" {
+			continue
+		}
+		seen := g.reachable(end.path, end.forward)
+		for path := range keep {
+			if !seen[path] {
+				delete(keep, path)
+			}
+		}
+	}
+	sub := new(graph)
+	for _, n := range g.Nodes {
+		if keep[n.ImportPath] {
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if keep[e.From] && keep[e.To] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	return sub, nil
+}
+
+// reachable returns the set of packages reachable from path, following
+// imports if forward is set, and importers otherwise.
+func (g *graph) reachable(path string, forward bool) map[string]bool {
+	next := make(map[string][]string)
+	for _, e := range g.Edges {
+		if forward {
+			next[e.From] = append(next[e.From], e.To)
+		} else {
+			next[e.To] = append(next[e.To], e.From)
+		}
+	}
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, q := range next[p] {
+			if !seen[q] {
+				seen[q] = true
+				queue = append(queue, q)
+			}
+		}
+	}
+	return seen
+}
+
+// writeDOT writes g to w in the Graphviz DOT language. Packages from
+// the standard library are drawn in grey, and imports by tests dashed.
+func writeDOT(w io.Writer, g *graph) error {
+	fmt.Fprintf(w, "digraph gogo {\n")
+	for _, n := range g.Nodes {
+		if n.Std {
+			fmt.Fprintf(w, "\t%s [color=gray, fontcolor=gray];\n", strconv.Quote(n.ImportPath))
+		} else {
+			fmt.Fprintf(w, "\t%s;\n", strconv.Quote(n.ImportPath))
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Test {
+			fmt.Fprintf(w, "\t%s -> %s [style=dashed];\n", strconv.Quote(e.From), strconv.Quote(e.To))
+		} else {
+			fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+var GraphCmd = &Command{
+	Run: func(proj *project.Project, args []string) error {
+		pkgs, err := resolvePackages(proj, args)
+		if err != nil {
+			return err
+		}
+		g, err := loadGraph(proj, pkgs)
+		if err != nil {
+			return err
+		}
+		if g, err = g.subgraph(GraphFrom, GraphTo); err != nil {
+			return err
+		}
+		if !JSON {
+			return writeDOT(os.Stdout, g)
+		}
+		data, err := json.MarshalIndent(g, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+		return err
+	},
+	AddFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&A, "a", false, "graph all packages in this project")
+		fs.BoolVar(&JSON, "json", false, "print the graph as JSON, rather than Graphviz DOT")
+		fs.BoolVar(&GraphTest, "test", false, "include the imports of tests")
+		fs.BoolVar(&GraphStd, "std", false, "include packages from the standard library")
+		fs.StringVar(&GraphFrom, "from", "", "only include packages imported, directly or indirectly, by this package")
+		fs.StringVar(&GraphTo, "to", "", "only include packages importing, directly or indirectly, this package")
+	},
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// testGraph is
+//
+//	a -> b -> c -> d
+//	a -> e
+//	b -> fmt
+//	x -> c
+func testGraph() *graph {
+	return &graph{
+		Nodes: []graphNode{{ImportPath: "a"}, {ImportPath: "b"}, {ImportPath: "c"}, {ImportPath: "d"}, {ImportPath: "e"}, {ImportPath: "fmt", Std: true}, {ImportPath: "x"}},
+		Edges: []graphEdge{
+			{From: "a", To: "b"},
+			{From: "a", To: "e"},
+			{From: "b", To: "c"},
+			{From: "b", To: "fmt"},
+			{From: "c", To: "d"},
+			{From: "x", To: "c"},
+		},
+	}
+}
+
+var subgraphTests = []struct {
+	from, to string
+	nodes    []string
+	edges    []string
+	err      string
+}{
+	{
+		nodes: []string{"a", "b", "c", "d", "e", "fmt", "x"},
+		edges: []string{"a b", "a e", "b c", "b fmt", "c d", "x c"},
+	}, {
+		from:  "b",
+		nodes: []string{"b", "c", "d", "fmt"},
+		edges: []string{"b c", "b fmt", "c d"},
+	}, {
+		to:    "c",
+		nodes: []string{"a", "b", "c", "x"},
+		edges: []string{"a b", "b c", "x c"},
+	}, {
+		from:  "a",
+		to:    "c",
+		nodes: []string{"a", "b", "c"},
+		edges: []string{"a b", "b c"},
+	}, {
+		from:  "d",
+		to:    "a",
+		nodes: nil,
+		edges: nil,
+	}, {
+		from: "nope",
+		err:  `package "nope" is not in the graph`,
+	}, {
+		to:  "nope",
+		err: `package "nope" is not in the graph`,
+	},
+}
+
+func TestSubgraph(t *testing.T) {
+	for _, tt := range subgraphTests {
+		g, err := testGraph().subgraph(tt.from, tt.to)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("subgraph(%q, %q): expected error %q, got %v", tt.from, tt.to, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("subgraph(%q, %q): %v", tt.from, tt.to, err)
+			continue
+		}
+		var nodes, edges []string
+		for _, n := range g.Nodes {
+			nodes = append(nodes, n.ImportPath)
+		}
+		for _, e := range g.Edges {
+			edges = append(edges, e.From+" "+e.To)
+		}
+		if !reflect.DeepEqual(tt.nodes, nodes) {
+			t.Errorf("subgraph(%q, %q): expected nodes %q, got %q", tt.from, tt.to, tt.nodes, nodes)
+		}
+		if !reflect.DeepEqual(tt.edges, edges) {
+			t.Errorf("subgraph(%q, %q): expected edges %q, got %q", tt.from, tt.to, tt.edges, edges)
+		}
+	}
+}
+
+var addEdgeTests = []struct {
+	tests []bool // the edges added, whether each is by a test
+	want  bool
+}{
+	{[]bool{false}, false},
+	{[]bool{true}, true},
+	{[]bool{true, true}, true},
+	{[]bool{true, false}, false},
+	{[]bool{false, true}, false},
+}
+
+func TestAddEdge(t *testing.T) {
+	for _, tt := range addEdgeTests {
+		b := &graphBuilder{
+			nodes: make(map[string]graphNode),
+			edges: make(map[[2]string]graphEdge),
+		}
+		for _, test := range tt.tests {
+			b.addEdge("a", "b", test)
+		}
+		want := []graphEdge{{From: "a", To: "b", Test: tt.want}}
+		if got := b.graph().Edges; !reflect.DeepEqual(want, got) {
+			t.Errorf("addEdge %v: expected %v, got %v", tt.tests, want, got)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := &graph{
+		Nodes: []graphNode{{ImportPath: "a"}, {ImportPath: "b"}, {ImportPath: "fmt", Std: true}},
+		Edges: []graphEdge{
+			{From: "a", To: "b"},
+			{From: "a", To: "fmt", Test: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeDOT(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph gogo {
+	"a";
+	"b";
+	"fmt" [color=gray, fontcolor=gray];
+	"a" -> "b";
+	"a" -> "fmt" [style=dashed];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeDOT: expected\n%s\ngot\n%s", want, got)
+	}
+}
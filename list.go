@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	gobuild "go/build"
+	"os"
+
+	"github.com/davecheney/gogo/project"
+)
+
+func init() {
+	registerCommand("list", ListCmd)
+}
+
+// listPackage is the description of a package printed by gogo list -json.
+type listPackage struct {
+	*gobuild.Package
+
+	// shadow the positions of each import, so they are omitted.
+	ImportPos, TestImportPos, XTestImportPos *struct{} `json:",omitempty"`
+
+	// ImportMap maps the imports which were satisfied by a vendor
+	// directory to the vendored package.
+	ImportMap map[string]string `json:",omitempty"`
+
+	// files matched by the //go:embed patterns of the package and its tests.
+	EmbedFiles      []string `json:",omitempty"`
+	TestEmbedFiles  []string `json:",omitempty"`
+	XTestEmbedFiles []string `json:",omitempty"`
+}
+
+func newListPackage(pkg *gobuild.Package) (*listPackage, error) {
+	p := &listPackage{
+		Package:   pkg,
+		ImportMap: project.ImportMap(pkg),
+	}
+	for _, e := range []struct {
+		patterns []string
+		files    *[]string
+	}{
+		{pkg.EmbedPatterns, &p.EmbedFiles},
+		{pkg.TestEmbedPatterns, &p.TestEmbedFiles},
+		{pkg.XTestEmbedPatterns, &p.XTestEmbedFiles},
+	} {
+		if len(e.patterns) == 0 {
+			continue
+		}
+		files, _, err := project.ResolveEmbed(pkg.Dir, e.patterns)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pkg.ImportPath, err)
+		}
+		*e.files = files
+	}
+	return p, nil
+}
+
+var ListCmd = &Command{
+	Run: func(proj *project.Project, args []string) error {
+		pkgs, err := resolvePackages(proj, args)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			if !JSON {
+				fmt.Println(pkg.ImportPath)
+				continue
+			}
+			p, err := newListPackage(pkg)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(p, "", "\t")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "%s\n", data)
+		}
+		return nil
+	},
+	AddFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&A, "a", false, "list all packages in this project")
+		fs.BoolVar(&JSON, "json", false, "print a JSON description of each package, including the files matched by //go:embed patterns")
+	},
+}
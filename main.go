@@ -27,13 +27,16 @@ func mustGetwd() string {
 }
 
 // findProjectRoot works upwards from path seaching for the
-// .gogo directory which identifies the project root.
+// .gogo directory, or go.mod file, which identifies the project root.
 // If path is within GOPATH, the project root will be set to the
 // matching element of GOPATH
 func findProjectRoot(path string) (string, error) {
 	gopaths := filepath.SplitList(os.Getenv("GOPATH"))
 	start := path
 	for path != "/" {
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+			return path, nil
+		}
 		root := filepath.Join(path, projectdir)
 		if _, err := os.Stat(root); err != nil {
 			if os.IsNotExist(err) {
@@ -59,6 +62,9 @@ var (
 	goarch    = fs.String("goarch", runtime.GOARCH, "override GOARCH")
 	goroot    = fs.String("goroot", runtime.GOROOT(), "override GOROOT")
 	toolchain = fs.String("toolchain", "gc", "choose go compiler toolchain")
+	cc        = fs.String("cc", "gcc", "override the C compiler used by cgo")
+	cxx       = fs.String("cxx", "g++", "override the C++ compiler used by cgo")
+	cgo       = fs.Bool("cgo", true, "enable cgo")
 )
 
 func init() {
@@ -102,6 +108,29 @@ func main() {
 		log.Fatalf("could not parse flags: %v", err)
 	}
 
+	// flags set on the command line override the environment
+	// and the project configuration.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cc":
+			project.Setenv("CC", *cc)
+		case "cxx":
+			project.Setenv("CXX", *cxx)
+		case "cgo":
+			enabled := "0"
+			if *cgo {
+				enabled = "1"
+			}
+			project.Setenv("CGO_ENABLED", enabled)
+		case "checkimports":
+			enabled := "0"
+			if CheckImports {
+				enabled = "1"
+			}
+			project.Setenv("GOGO_CHECKIMPORTS", enabled)
+		}
+	})
+
 	// must be below fs.Parse because the -q and -v flags will log.Infof
 	log.Infof("project root %q", root)
 	args = fs.Args()
@@ -109,6 +138,9 @@ func main() {
 		args = []string{"."}
 	}
 	if err := cmd.Run(project, args); err != nil {
+		if status, ok := err.(exitStatus); ok {
+			os.Exit(int(status))
+		}
 		log.Fatalf("command %q failed: %v", name, err)
 	}
 }
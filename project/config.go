@@ -0,0 +1,108 @@
+package project
+
+// project configuration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// configFile is the name of the project configuration file,
+// relative to the .gogo directory.
+const configFile = "config"
+
+// parseConfig parses a project configuration file. Each line of the
+// file is a KEY=value pair; blank lines and lines starting with # are
+// ignored.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	config := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value, got %q", configFile, n, line)
+		}
+		config[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return config, s.Err()
+}
+
+// readConfig reads the configuration file at path.
+// A missing configuration file is not an error.
+func readConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]string), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfig(f)
+}
+
+// Getenv returns the value of the variable key. Values set with
+// Setenv take precedence over the environment, which takes precedence
+// over the project configuration file, $PROJECT/.gogo/config.
+func (p *Project) Getenv(key string) string {
+	p.envMu.Lock()
+	defer p.envMu.Unlock()
+	if v, ok := p.override[key]; ok {
+		return v
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return p.config[key]
+}
+
+// Setenv overrides the value of the variable key for this project,
+// for example from a command line flag. Setenv must be called before
+// any packages are resolved.
+func (p *Project) Setenv(key, value string) {
+	p.envMu.Lock()
+	defer p.envMu.Unlock()
+	if p.override == nil {
+		p.override = make(map[string]string)
+	}
+	p.override[key] = value
+}
+
+// GetenvList returns the value of the variable key, or def if it is
+// empty, split into a list of arguments. Arguments may be quoted.
+func (p *Project) GetenvList(key, def string) ([]string, error) {
+	v := p.Getenv(key)
+	if v == "" {
+		v = def
+	}
+	args, err := splitQuoted(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return args, nil
+}
+
+// SplitQuoted splits s into a list of arguments, as GetenvList does.
+func SplitQuoted(s string) ([]string, error) { return splitQuoted(s) }
+
+// CgoEnabled reports whether cgo is enabled for this project.
+// cgo is enabled unless CGO_ENABLED is set to 0.
+func (p *Project) CgoEnabled() bool {
+	return p.Getenv("CGO_ENABLED") != "0"
+}
+
+// spec returns the Spec used to scan the packages of this project
+// for goos and goarch.
+func (p *Project) spec(goos, goarch string) Spec {
+	s := DefaultSpec()
+	s.goos, s.goarch = goos, goarch
+	s.cgoEnabled = p.CgoEnabled()
+	return s
+}
@@ -0,0 +1,85 @@
+package project
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var parseConfigTests = []struct {
+	config string
+	want   map[string]string
+	err    bool
+}{
+	{"", map[string]string{}, false},
+	{"CC=clang\n", map[string]string{"CC": "clang"}, false},
+	{"# comment\n\n CC = clang \nCGO_CFLAGS=-O2 -g\n", map[string]string{"CC": "clang", "CGO_CFLAGS": "-O2 -g"}, false},
+	{"CGO_ENABLED=\n", map[string]string{"CGO_ENABLED": ""}, false},
+	{"CC\n", nil, true},
+	{"=clang\n", nil, true},
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, tt := range parseConfigTests {
+		got, err := parseConfig(strings.NewReader(tt.config))
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseConfig(%q): expected error", tt.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseConfig(%q): %v", tt.config, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseConfig(%q): expected %q, got %q", tt.config, tt.want, got)
+		}
+	}
+}
+
+func TestGetenv(t *testing.T) {
+	const key = "GOGO_TEST_GETENV"
+	p := &Project{config: map[string]string{key: "config"}}
+	if got := p.Getenv(key); got != "config" {
+		t.Errorf("Getenv: expected %q, got %q", "config", got)
+	}
+	os.Setenv(key, "env")
+	defer os.Unsetenv(key)
+	if got := p.Getenv(key); got != "env" {
+		t.Errorf("Getenv: expected %q, got %q", "env", got)
+	}
+	p.Setenv(key, "flag")
+	if got := p.Getenv(key); got != "flag" {
+		t.Errorf("Getenv: expected %q, got %q", "flag", got)
+	}
+}
+
+var cgoEnabledTests = []struct {
+	enabled                           string
+	gofiles, cgofiles, ignoredgofiles []string
+}{
+	{"1", nil, []string{"cgo.go"}, []string{"nocgo.go"}},
+	{"0", []string{"nocgo.go"}, nil, []string{"cgo.go"}},
+}
+
+func TestCgoEnabled(t *testing.T) {
+	for _, tt := range cgoEnabledTests {
+		prj := newProject(t)
+		prj.Setenv("CGO_ENABLED", tt.enabled)
+		p, err := prj.ResolvePackage(GOOS, GOARCH, "nocgo").Result()
+		if err != nil {
+			t.Fatalf("resolvepackage: %v", err)
+		}
+		if !reflect.DeepEqual(tt.gofiles, p.GoFiles) {
+			t.Errorf("CGO_ENABLED=%s: pkg.GoFiles: expected %q, got %q", tt.enabled, tt.gofiles, p.GoFiles)
+		}
+		if !reflect.DeepEqual(tt.cgofiles, p.CgoFiles) {
+			t.Errorf("CGO_ENABLED=%s: pkg.CgoFiles: expected %q, got %q", tt.enabled, tt.cgofiles, p.CgoFiles)
+		}
+		if !reflect.DeepEqual(tt.ignoredgofiles, p.IgnoredGoFiles) {
+			t.Errorf("CGO_ENABLED=%s: pkg.IgnoredGoFiles: expected %q, got %q", tt.enabled, tt.ignoredgofiles, p.IgnoredGoFiles)
+		}
+	}
+}
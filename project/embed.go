@@ -0,0 +1,256 @@
+package project
+
+// go:embed support
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// embedDirectives returns the patterns of the //go:embed directives
+// in f, and the position of each.
+func embedDirectives(fset *token.FileSet, f *ast.File) ([]string, []token.Position, error) {
+	var patterns []string
+	var positions []token.Position
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, "//go:embed") {
+				continue
+			}
+			args := c.Text[len("//go:embed"):]
+			if args != "" && args[0] != ' ' && args[0] != '\t' {
+				// //go:embedded, or similar.
+				continue
+			}
+			pos := fset.Position(c.Pos())
+			list, err := parseGoEmbed(args)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: invalid //go:embed: %v", pos, err)
+			}
+			if len(list) == 0 {
+				return nil, nil, fmt.Errorf("%s: usage: //go:embed pattern...", pos)
+			}
+			for _, p := range list {
+				patterns = append(patterns, p)
+				positions = append(positions, pos)
+			}
+		}
+	}
+	return patterns, positions, nil
+}
+
+// parseGoEmbed splits the arguments of a //go:embed directive into
+// patterns. Patterns are separated by spaces and may be quoted, in
+// either Go string or raw string syntax.
+func parseGoEmbed(args string) ([]string, error) {
+	var list []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var p string
+		switch args[0] {
+		case '`':
+			i := strings.Index(args[1:], "`")
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated raw string: %s", args)
+			}
+			p, args = args[1:1+i], args[2+i:]
+		case '"':
+			i := 1
+			for ; i < len(args); i++ {
+				if args[i] == '\\' {
+					i++
+					continue
+				}
+				if args[i] == '"' {
+					break
+				}
+			}
+			if i >= len(args) {
+				return nil, fmt.Errorf("unterminated string: %s", args)
+			}
+			q, err := strconv.Unquote(args[:i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %s", args[:i+1])
+			}
+			p, args = q, args[i+1:]
+		default:
+			i := strings.IndexFunc(args, unicode.IsSpace)
+			if i < 0 {
+				i = len(args)
+			}
+			p, args = args[:i], args[i:]
+		}
+		if args != "" {
+			r, _ := utf8.DecodeRuneInString(args)
+			if !unicode.IsSpace(r) {
+				return nil, fmt.Errorf("invalid quoted string: %s", p+args)
+			}
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// addEmbedPatterns records patterns, found at positions, in pkg.
+// test and xtest select the patterns of the package's tests.
+func addEmbedPatterns(pkg *build.Package, patterns []string, positions []token.Position, test, xtest bool) {
+	list, pos := &pkg.EmbedPatterns, &pkg.EmbedPatternPos
+	switch {
+	case xtest:
+		list, pos = &pkg.XTestEmbedPatterns, &pkg.XTestEmbedPatternPos
+	case test:
+		list, pos = &pkg.TestEmbedPatterns, &pkg.TestEmbedPatternPos
+	}
+	if *pos == nil {
+		*pos = make(map[string][]token.Position)
+	}
+	for i, p := range patterns {
+		if !contains(*list, p) {
+			*list = append(*list, p)
+		}
+		(*pos)[p] = append((*pos)[p], positions[i])
+	}
+	sort.Strings(*list)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveEmbed expands the //go:embed patterns against the package
+// directory dir. It returns the embedded files, as slash separated
+// paths relative to dir, and the files matched by each pattern.
+//
+// A pattern naming a directory embeds the files below it, except
+// those whose names begin with . or _, unless the pattern is prefixed
+// with all:. Patterns may not contain . or .. elements, match files
+// in another module, or match nothing.
+func ResolveEmbed(dir string, patterns []string) ([]string, map[string][]string, error) {
+	pmap := make(map[string][]string)
+	have := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		glob, all := pattern, false
+		if strings.HasPrefix(glob, "all:") {
+			glob, all = glob[len("all:"):], true
+		}
+		if !validEmbedPattern(glob) {
+			return nil, nil, fmt.Errorf("pattern %s: invalid pattern syntax", pattern)
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(glob)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("pattern %s: %v", pattern, err)
+		}
+		var list []string
+		for _, match := range matches {
+			rel := filepath.ToSlash(match[len(dir)+1:])
+			what := "file"
+			fi, err := os.Lstat(match)
+			if err != nil {
+				return nil, nil, err
+			}
+			if fi.IsDir() {
+				what = "directory"
+			}
+			for elem := rel; elem != "."; elem = path.Dir(elem) {
+				if isBadEmbedName(path.Base(elem)) {
+					return nil, nil, fmt.Errorf("pattern %s: cannot embed %s %s: invalid name %s", pattern, what, rel, path.Base(elem))
+				}
+			}
+			for d := filepath.Dir(match); d != dir; d = filepath.Dir(d) {
+				if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+					return nil, nil, fmt.Errorf("pattern %s: cannot embed %s %s: in different module", pattern, what, rel)
+				}
+			}
+			switch {
+			case fi.Mode().IsRegular():
+				list = append(list, rel)
+			case fi.IsDir():
+				n := len(list)
+				err := filepath.Walk(match, func(p string, fi os.FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+					name := fi.Name()
+					if p != match && (isBadEmbedName(name) || ((name[0] == '.' || name[0] == '_') && !all)) {
+						if fi.IsDir() {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					if fi.IsDir() {
+						if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					if !fi.Mode().IsRegular() {
+						return fmt.Errorf("pattern %s: cannot embed irregular file %s", pattern, filepath.ToSlash(p[len(dir)+1:]))
+					}
+					list = append(list, filepath.ToSlash(p[len(dir)+1:]))
+					return nil
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				if len(list) == n {
+					return nil, nil, fmt.Errorf("pattern %s: cannot embed directory %s: contains no embeddable files", pattern, rel)
+				}
+			default:
+				return nil, nil, fmt.Errorf("pattern %s: cannot embed irregular file %s", pattern, rel)
+			}
+		}
+		if len(list) == 0 {
+			return nil, nil, fmt.Errorf("pattern %s: no matching files found", pattern)
+		}
+		sort.Strings(list)
+		pmap[pattern] = list
+		for _, file := range list {
+			if !have[file] {
+				have[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, pmap, nil
+}
+
+// validEmbedPattern reports whether pattern is a valid, unrooted,
+// slash separated path which does not contain . or .. elements.
+func validEmbedPattern(pattern string) bool {
+	if pattern == "" || pattern == "." || strings.Contains(pattern, `\`) {
+		return false
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// isBadEmbedName reports whether name is the name of a file or
+// directory which may never be embedded.
+func isBadEmbedName(name string) bool {
+	switch name {
+	case "", ".bzr", ".hg", ".git", ".svn":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var parseGoEmbedTests = []struct {
+	args string
+	want []string
+	err  bool
+}{
+	{"", nil, false},
+	{" a.txt", []string{"a.txt"}, false},
+	{" a.txt\tstatic/*.html", []string{"a.txt", "static/*.html"}, false},
+	{` "with space.txt" b.txt`, []string{"with space.txt", "b.txt"}, false},
+	{" `raw string.txt`", []string{"raw string.txt"}, false},
+	{` "unterminated`, nil, true},
+	{` "a.txt"b.txt`, nil, true},
+}
+
+func TestParseGoEmbed(t *testing.T) {
+	for _, tt := range parseGoEmbedTests {
+		got, err := parseGoEmbed(tt.args)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseGoEmbed(%q): expected error", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGoEmbed(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGoEmbed(%q): expected %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestPackageEmbedPatterns(t *testing.T) {
+	prj := newProject(t)
+	p, err := prj.ResolvePackage(GOOS, GOARCH, "embeddata").Result()
+	if err != nil {
+		t.Fatalf("resolvepackage: %v", err)
+	}
+	if want := []string{"hello.txt", "static"}; !reflect.DeepEqual(want, p.EmbedPatterns) {
+		t.Errorf("pkg.EmbedPatterns: expected %q, got %q", want, p.EmbedPatterns)
+	}
+	if want := []string{"testdata/golden.txt"}; !reflect.DeepEqual(want, p.TestEmbedPatterns) {
+		t.Errorf("pkg.TestEmbedPatterns: expected %q, got %q", want, p.TestEmbedPatterns)
+	}
+	if n := len(p.EmbedPatternPos["hello.txt"]); n != 2 {
+		t.Errorf("pkg.EmbedPatternPos[hello.txt]: expected 2 positions, got %d", n)
+	}
+}
+
+var resolveEmbedTests = []struct {
+	patterns []string
+	files    []string
+	err      string
+}{
+	{[]string{"hello.txt"}, []string{"hello.txt"}, ""},
+	{[]string{"static"}, []string{"static/a.txt", "static/sub/b.txt"}, ""},
+	{[]string{"all:static"}, []string{"static/.hidden", "static/_skip.txt", "static/a.txt", "static/sub/b.txt"}, ""},
+	{[]string{"static/.hidden"}, []string{"static/.hidden"}, ""},
+	{[]string{"*.txt", "hello.txt"}, []string{"hello.txt"}, ""},
+	{[]string{"../hello.txt"}, nil, "invalid pattern syntax"},
+	{[]string{"./hello.txt"}, nil, "invalid pattern syntax"},
+	{[]string{"/hello.txt"}, nil, "invalid pattern syntax"},
+	{[]string{"missing.txt"}, nil, "no matching files found"},
+	{[]string{"static/mod/c.txt"}, nil, "in different module"},
+}
+
+func TestResolveEmbed(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join(root, "src", "embeddata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range resolveEmbedTests {
+		files, pmap, err := ResolveEmbed(dir, tt.patterns)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ResolveEmbed(%q): expected error %q, got %v", tt.patterns, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveEmbed(%q): %v", tt.patterns, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("ResolveEmbed(%q): expected %q, got %q", tt.patterns, tt.files, files)
+		}
+		if len(pmap) != len(tt.patterns) {
+			t.Errorf("ResolveEmbed(%q): expected %d patterns, got %v", tt.patterns, len(tt.patterns), pmap)
+		}
+	}
+}
+
+func TestResolveEmbedIrregular(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogo-embed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "static"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "static", "a.txt"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "static", "b.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	for _, pattern := range []string{"static", "static/b.txt"} {
+		want := "pattern " + pattern + ": cannot embed irregular file static/b.txt"
+		if _, _, err := ResolveEmbed(dir, []string{pattern}); err == nil || err.Error() != want {
+			t.Errorf("ResolveEmbed(%q): expected error %q, got %v", pattern, want, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package project
+
+// internal package visibility
+
+import "strings"
+
+// internalParent returns the import path of the tree which may import
+// path. If path is not an internal package, or any package may import
+// it, ok is false.
+func internalParent(path string) (parent string, ok bool) {
+	switch {
+	case strings.HasSuffix(path, "/internal"):
+		return path[:len(path)-len("/internal")], true
+	case strings.Contains(path, "/internal/"):
+		return path[:strings.LastIndex(path, "/internal/")], true
+	}
+	// internal packages at the root of a source tree may be
+	// imported by any package in that tree, see internalAllowed.
+	return "", false
+}
+
+// internalAllowed reports whether the package importer may import
+// path. If it may not, the prefix of the packages which may import
+// path is returned. The internal packages at the root of the standard
+// library, reported by isStdlib, may only be imported by the standard
+// library, in which case the prefix is empty.
+func internalAllowed(importer, path string, isStdlib func(string) bool) (string, bool) {
+	if (path == "internal" || strings.HasPrefix(path, "internal/")) && isStdlib(path) && !isStdlib(importer) {
+		return "", false
+	}
+	parent, ok := internalParent(path)
+	if !ok || importer == parent || strings.HasPrefix(importer, parent+"/") {
+		return "", true
+	}
+	return parent, false
+}
@@ -0,0 +1,44 @@
+package project
+
+import "testing"
+
+var internalAllowedTests = []struct {
+	importer, path string
+	parent         string
+	ok             bool
+}{
+	{"a", "b", "", true},
+	{"a/b", "a/internal", "", true},
+	{"a", "a/internal/c", "", true},
+	{"a/b", "a/internal/c", "", true},
+	{"a/b/c", "a/b/internal/d/internal/e", "a/b/internal/d", false},
+	{"a/b/internal/d", "a/b/internal/d/internal/e", "", true},
+	{"ab", "a/internal/c", "a", false},
+	{"x", "a/internal", "a", false},
+	{"x", "internal/c", "", true},
+	{"x", "a/internals/c", "", true},
+	{"x", "internal/race", "", false},
+	{"x", "internal", "", false},
+	{"fmt", "internal/race", "", true},
+	{"x", "crypto/internal/boring", "crypto", false},
+	{"crypto/tls", "crypto/internal/boring", "", true},
+}
+
+// isStdlibTest reports whether path is in the standard library of
+// internalAllowedTests.
+func isStdlibTest(path string) bool {
+	switch path {
+	case "fmt", "internal", "internal/race", "crypto/tls", "crypto/internal/boring":
+		return true
+	}
+	return false
+}
+
+func TestInternalAllowed(t *testing.T) {
+	for _, tt := range internalAllowedTests {
+		parent, ok := internalAllowed(tt.importer, tt.path, isStdlibTest)
+		if ok != tt.ok || (!ok && parent != tt.parent) {
+			t.Errorf("internalAllowed(%q, %q): expected %q %v, got %q %v", tt.importer, tt.path, tt.parent, tt.ok, parent, ok)
+		}
+	}
+}
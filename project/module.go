@@ -0,0 +1,440 @@
+package project
+
+// go.mod support
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// modVersion identifies a version of a module. A modVersion on the
+// right hand side of a replace directive with an empty Version names
+// a directory.
+type modVersion struct {
+	Path, Version string
+}
+
+func (m modVersion) String() string { return m.Path + "@" + m.Version }
+
+// modReplace is a replace directive. If Old.Version is empty all
+// versions of Old.Path are replaced.
+type modReplace struct {
+	Old, New modVersion
+}
+
+// modFile is the parsed form of a go.mod file. Only the directives
+// gogo uses are recorded.
+type modFile struct {
+	Module  string
+	Require []modVersion
+	Replace []modReplace
+}
+
+// parseModFile parses the contents of the go.mod file name.
+func parseModFile(name string, data []byte) (*modFile, error) {
+	f := new(modFile)
+	var block string // the directive of the enclosing ( ) block, if any
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		args, err := modFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		verb := block
+		switch {
+		case block != "" && len(args) == 1 && args[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(args) == 2 && args[1] == "(":
+			block = args[0]
+			continue
+		case block == "":
+			verb, args = args[0], args[1:]
+		}
+		switch verb {
+		case "module":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%s:%d: usage: module module/path", name, n)
+			}
+			f.Module = args[0]
+		case "require":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("%s:%d: usage: require module/path v1.2.3", name, n)
+			}
+			f.Require = append(f.Require, modVersion{args[0], args[1]})
+		case "replace":
+			r, err := parseReplace(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+			}
+			f.Replace = append(f.Replace, r)
+		default:
+			// go, exclude, retract and toolchain directives
+			// do not affect how packages are resolved.
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if block != "" {
+		return nil, fmt.Errorf("%s: unterminated %s block", name, block)
+	}
+	if f.Module == "" {
+		return nil, fmt.Errorf("%s: no module directive", name)
+	}
+	return f, nil
+}
+
+// parseReplace parses the arguments of a replace directive,
+//
+//	module/path [v1.2.3] => other/module v1.4.5
+//	module/path [v1.2.3] => ../local/directory
+func parseReplace(args []string) (modReplace, error) {
+	var r modReplace
+	i := 0
+	for ; i < len(args) && args[i] != "=>"; i++ {
+	}
+	if i == len(args) || i < 1 || i > 2 || len(args)-i-1 < 1 || len(args)-i-1 > 2 {
+		return r, fmt.Errorf("usage: replace module/path [v1.2.3] => other/module v1.4.5 or local/directory")
+	}
+	r.Old.Path = args[0]
+	if i == 2 {
+		r.Old.Version = args[1]
+	}
+	r.New.Path = args[i+1]
+	if len(args)-i-1 == 2 {
+		r.New.Version = args[i+2]
+	} else if !isLocalPath(r.New.Path) {
+		return r, fmt.Errorf("replacement module %s without version must be a directory path (rooted or starting with ./ or ../)", r.New.Path)
+	}
+	return r, nil
+}
+
+// isLocalPath reports whether the target of a replace directive is a
+// directory rather than a module path.
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// modFields splits a line of a go.mod file into its fields. Fields may
+// be quoted, in either Go string or raw string syntax.
+func modFields(line string) ([]string, error) {
+	var fields []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		switch line[0] {
+		case '"', '`':
+			i := 1
+			for ; i < len(line) && line[i] != line[0]; i++ {
+				if line[0] == '"' && line[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated string: %s", line)
+			}
+			s, err := strconv.Unquote(line[:i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %s", line[:i+1])
+			}
+			fields, line = append(fields, s), line[i+1:]
+		default:
+			i := strings.IndexFunc(line, unicode.IsSpace)
+			if i < 0 {
+				i = len(line)
+			}
+			fields, line = append(fields, line[:i]), line[i:]
+		}
+	}
+	return fields, nil
+}
+
+// parseGoSum parses the contents of a go.sum file into a map from
+// "path version" and "path version/go.mod" to the hashes recorded for
+// them.
+func parseGoSum(name string, data []byte) (map[string][]string, error) {
+	sums := make(map[string][]string)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		f := strings.Fields(s.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("%s:%d: malformed go.sum line", name, n)
+		}
+		key := f[0] + " " + f[1]
+		sums[key] = append(sums[key], f[2])
+	}
+	return sums, s.Err()
+}
+
+// escapePath returns the module path as it is stored in the module
+// cache. Upper case letters, which case insensitive file systems
+// cannot tell apart, are replaced by ! followed by the lower case
+// letter.
+func escapePath(path string) string {
+	var buf bytes.Buffer
+	for _, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			buf.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// hash1 returns the "h1:" hash of the named files, as recorded in
+// go.sum. open returns the contents of each file.
+func hash1(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+	summary := sha256.New()
+	for _, file := range files {
+		if strings.Contains(file, "\n") {
+			return "", fmt.Errorf("filenames with newlines are not supported")
+		}
+		r, err := open(file)
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), file)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// hashDir returns the hash of the files below dir, named as if they
+// were below prefix, which is how go.sum records the hash of a module.
+func hashDir(dir, prefix string) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			rel := filepath.ToSlash(path[len(dir)+1:])
+			files = append(files, prefix+"/"+rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash1(files, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, filepath.FromSlash(name[len(prefix)+1:])))
+	})
+}
+
+// hashGoMod returns the hash of the go.mod file data, which is how
+// go.sum records the go.mod of a module.
+func hashGoMod(data []byte) (string, error) {
+	return hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// module is the main module of a project whose root contains a go.mod
+// file.
+type module struct {
+	dir  string // the module root
+	file *modFile
+	sums map[string][]string // from go.sum
+
+	mu       sync.Mutex
+	verified map[modVersion]error // protected by mu
+}
+
+// readModule reads the go.mod and go.sum files in dir. A missing
+// go.sum file is not an error, but any module resolved from the module
+// cache will fail to verify.
+func readModule(dir string) (*module, error) {
+	name := filepath.Join(dir, "go.mod")
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseModFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string][]string)
+	name = filepath.Join(dir, "go.sum")
+	data, err = ioutil.ReadFile(name)
+	switch {
+	case err == nil:
+		if sums, err = parseGoSum(name, data); err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	return &module{
+		dir:      dir,
+		file:     f,
+		sums:     sums,
+		verified: make(map[modVersion]error),
+	}, nil
+}
+
+// inModule reports whether path is the module path prefix, or a package
+// inside it, and returns path relative to prefix.
+func inModule(prefix, path string) (string, bool) {
+	switch {
+	case path == prefix:
+		return "", true
+	case strings.HasPrefix(path, prefix+"/"):
+		return path[len(prefix)+1:], true
+	}
+	return "", false
+}
+
+// replacement returns the replacement for the required module m, or m
+// if it is not replaced. A replace directive naming a version takes
+// precedence over one which does not.
+func (m *module) replacement(mv modVersion) modVersion {
+	var found *modReplace
+	for i := range m.file.Replace {
+		r := &m.file.Replace[i]
+		if r.Old.Path != mv.Path || (r.Old.Version != "" && r.Old.Version != mv.Version) {
+			continue
+		}
+		if found == nil || r.Old.Version != "" {
+			found = r
+		}
+	}
+	if found == nil {
+		return mv
+	}
+	return found.New
+}
+
+// Dir returns the directory of the package with import path. Packages
+// inside the main module are found below its root, other packages in
+// the required module which provides them, after applying any
+// replace directives. Modules are not downloaded, they must already be
+// present in modcache.
+func (m *module) Dir(modcache, path string) (string, error) {
+	if rel, ok := inModule(m.file.Module, path); ok {
+		return filepath.Join(m.dir, filepath.FromSlash(rel)), nil
+	}
+	var req *modVersion
+	var rel string
+	for i := range m.file.Require {
+		r := &m.file.Require[i]
+		if p, ok := inModule(r.Path, path); ok && (req == nil || len(r.Path) > len(req.Path)) {
+			req, rel = r, p
+		}
+	}
+	if req == nil {
+		return "", fmt.Errorf("no required module provides package %s; add it to the require directives of %s", path, filepath.Join(m.dir, "go.mod"))
+	}
+	mv := m.replacement(*req)
+	if mv.Version == "" {
+		dir := filepath.FromSlash(mv.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(m.dir, dir)
+		}
+		return filepath.Join(dir, filepath.FromSlash(rel)), nil
+	}
+	dir := filepath.Join(modcache, filepath.FromSlash(escapePath(mv.Path)+"@"+escapePath(mv.Version)))
+	if err := m.verify(dir, mv); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// verify checks the contents of dir, the module cache directory for mv,
+// against go.sum. Each module version is checked once.
+func (m *module) verify(dir string, mv modVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err, ok := m.verified[mv]; ok {
+		return err
+	}
+	err := m.verifyDir(dir, mv)
+	m.verified[mv] = err
+	return err
+}
+
+func (m *module) verifyDir(dir string, mv modVersion) error {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("module %s is not in the module cache, %s does not exist; gogo does not download modules, run go mod download", mv, dir)
+	}
+	sums := m.sums[mv.Path+" "+mv.Version]
+	if len(sums) == 0 {
+		return fmt.Errorf("missing go.sum entry for module %s", mv)
+	}
+	h, err := hashDir(dir, mv.String())
+	if err != nil {
+		return fmt.Errorf("verifying module %s: %v", mv, err)
+	}
+	if !contains(sums, h) {
+		return fmt.Errorf("verifying module %s: checksum mismatch\n\tmodule cache: %s\n\tgo.sum:       %s", mv, h, sums[0])
+	}
+	if sums := m.sums[mv.Path+" "+mv.Version+"/go.mod"]; len(sums) > 0 {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if os.IsNotExist(err) {
+			// modules without a go.mod are given a synthesised one.
+			data, err = []byte(fmt.Sprintf("module %s\n", mv.Path)), nil
+		}
+		if err != nil {
+			return fmt.Errorf("verifying module %s: %v", mv, err)
+		}
+		h, err := hashGoMod(data)
+		if err != nil {
+			return err
+		}
+		if !contains(sums, h) {
+			return fmt.Errorf("verifying %s/go.mod: checksum mismatch\n\tmodule cache: %s\n\tgo.sum:       %s", mv, h, sums[0])
+		}
+	}
+	return nil
+}
+
+// modCache returns the module cache directory, $GOMODCACHE, or the
+// pkg/mod directory of the first $GOPATH entry.
+func (p *Project) modCache() string {
+	if dir := p.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(p.Getenv("GOPATH"))
+	if len(gopath) == 0 || gopath[0] == "" {
+		gopath = []string{filepath.Join(os.Getenv("HOME"), "go")}
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// ModulePath returns the module path declared by the go.mod file at
+// the root of the project, or "" if the project is not a module.
+func (p *Project) ModulePath() string {
+	if p.mod == nil {
+		return ""
+	}
+	return p.mod.file.Module
+}
@@ -0,0 +1,218 @@
+package project
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var parseModFileTests = []struct {
+	data string
+	want *modFile
+	err  string
+}{{
+	data: "module example.com/a\n",
+	want: &modFile{Module: "example.com/a"},
+}, {
+	data: `// comment
+module "example.com/a" // trailing comment
+
+go 1.16
+
+require example.com/b v1.2.3
+require (
+	example.com/c v0.1.0 // indirect
+	example.com/d v2.0.0+incompatible
+)
+
+replace example.com/b => ../b
+replace (
+	example.com/c v0.1.0 => example.com/e v0.2.0
+)
+exclude example.com/f v1.0.0
+`,
+	want: &modFile{
+		Module: "example.com/a",
+		Require: []modVersion{
+			{"example.com/b", "v1.2.3"},
+			{"example.com/c", "v0.1.0"},
+			{"example.com/d", "v2.0.0+incompatible"},
+		},
+		Replace: []modReplace{
+			{modVersion{"example.com/b", ""}, modVersion{"../b", ""}},
+			{modVersion{"example.com/c", "v0.1.0"}, modVersion{"example.com/e", "v0.2.0"}},
+		},
+	},
+}, {
+	data: "go 1.16\n",
+	err:  "go.mod: no module directive",
+}, {
+	data: "module example.com/a\nrequire example.com/b\n",
+	err:  "go.mod:2: usage: require module/path v1.2.3",
+}, {
+	data: "module example.com/a\nreplace example.com/b => example.com/c\n",
+	err:  "go.mod:2: replacement module example.com/c without version must be a directory path (rooted or starting with ./ or ../)",
+}, {
+	data: "module example.com/a\nrequire (\n\texample.com/b v1.0.0\n",
+	err:  "go.mod: unterminated require block",
+}, {
+	data: "module \"example.com/a\n",
+	err:  "go.mod:1: unterminated string: \"example.com/a",
+}}
+
+func TestParseModFile(t *testing.T) {
+	for _, tt := range parseModFileTests {
+		got, err := parseModFile("go.mod", []byte(tt.data))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseModFile(%q): expected error %q, got %v", tt.data, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseModFile(%q): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("parseModFile(%q): expected %+v, got %+v", tt.data, tt.want, got)
+		}
+	}
+}
+
+var escapePathTests = []struct {
+	path, want string
+}{
+	{"example.com/lib", "example.com/lib"},
+	{"github.com/Azure/azure-sdk", "github.com/!azure/azure-sdk"},
+	{"example.com/ABC", "example.com/!a!b!c"},
+}
+
+func TestEscapePath(t *testing.T) {
+	for _, tt := range escapePathTests {
+		if got := escapePath(tt.path); got != tt.want {
+			t.Errorf("escapePath(%q): expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	// the hashes in testdata/mod/app/go.sum were computed by
+	// golang.org/x/mod/sumdb/dirhash.
+	dir := filepath.Join(root, "mod", "modcache", "example.com", "lib@v1.0.0")
+	got, err := hashDir(dir, "example.com/lib@v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "h1:GV33wakVVJqvdBZNxUlzuAisw7KyqaEgeI2ehFtTiaY="; got != want {
+		t.Errorf("hashDir: expected %q, got %q", want, got)
+	}
+	got, err = hashGoMod([]byte("module example.com/lib\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "h1:4OAnUP7RpKJ0hg7ydNi+A/luktLxx7xSrw0c+FeAtlc="; got != want {
+		t.Errorf("hashGoMod: expected %q, got %q", want, got)
+	}
+}
+
+func newModuleProject(t *testing.T) *Project {
+	prj, err := NewProject(filepath.Join(root, "mod", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modcache, err := filepath.Abs(filepath.Join(root, "mod", "modcache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prj.Setenv("GOMODCACHE", modcache)
+	return prj
+}
+
+var resolveModuleTests = []struct {
+	path string
+	dir  string // relative to testdata/mod
+	err  string
+}{
+	{path: "example.com/app", dir: "app"},
+	{path: "example.com/app/util", dir: "app/util"},
+	{path: "example.com/lib", dir: "modcache/example.com/lib@v1.0.0"},
+	{path: "example.com/lib/sub", dir: "modcache/example.com/lib@v1.0.0/sub"},
+	{path: "example.com/local", dir: "local"},
+	{path: "example.com/Upper", err: "verifying module example.com/Upper@v1.0.0: checksum mismatch"},
+	{path: "example.com/nosum", err: "missing go.sum entry for module example.com/nosum@v1.0.0"},
+	{path: "example.com/other", err: "no required module provides package example.com/other"},
+}
+
+func TestResolveModulePackage(t *testing.T) {
+	prj := newModuleProject(t)
+	if got, want := prj.ModulePath(), "example.com/app"; got != want {
+		t.Errorf("ModulePath: expected %q, got %q", want, got)
+	}
+	base, err := filepath.Abs(filepath.Join(root, "mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range resolveModuleTests {
+		pkg, err := prj.ResolvePackage(GOOS, GOARCH, tt.path).Result()
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("ResolvePackage(%q): expected error %q, got %v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolvePackage(%q): %v", tt.path, err)
+			continue
+		}
+		if want := filepath.Join(base, filepath.FromSlash(tt.dir)); pkg.Dir != want {
+			t.Errorf("ResolvePackage(%q): expected Dir %q, got %q", tt.path, want, pkg.Dir)
+		}
+	}
+
+	pkg, err := prj.ResolvePackage(GOOS, GOARCH, "example.com/app").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := append([]string{}, pkg.Imports...)
+	sort.Strings(imports)
+	if want := []string{"example.com/app/util", "example.com/lib", "example.com/lib/sub", "example.com/local"}; !reflect.DeepEqual(want, imports) {
+		t.Errorf("pkg.Imports: expected %q, got %q", want, imports)
+	}
+	// context and io/fs are in the standard library, not a module.
+	pkg, err = prj.ResolvePackage(GOOS, GOARCH, "example.com/app/util").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Imports) != 0 {
+		t.Errorf("pkg.Imports: expected none, got %q", pkg.Imports)
+	}
+	for _, path := range []string{"context", "fmt", "io/fs"} {
+		if _, ok := pkg.ImportPos[path]; !ok {
+			t.Errorf("pkg.ImportPos: expected %q, got %v", path, pkg.ImportPos)
+		}
+	}
+}
+
+func TestModuleSrcDir(t *testing.T) {
+	prj := newModuleProject(t)
+	s := &prj.SrcDirs[0]
+	pkgs, err := s.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com/app", "example.com/app/util"}; !reflect.DeepEqual(want, pkgs) {
+		t.Errorf("FindAll: expected %q, got %q", want, pkgs)
+	}
+	path, err := s.ImportPath(filepath.Join(prj.Root(), "util"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "example.com/app/util"; path != want {
+		t.Errorf("ImportPath: expected %q, got %q", want, path)
+	}
+	if _, err := s.ImportPath(filepath.Dir(prj.Root())); err == nil {
+		t.Errorf("ImportPath(%q): expected error", filepath.Dir(prj.Root()))
+	}
+}
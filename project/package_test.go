@@ -1,6 +1,7 @@
 package project
 
 import (
+	"go/token"
 	"reflect"
 	"runtime"
 	"testing"
@@ -104,6 +105,13 @@ var scanFilesTests = []struct {
 	gofiles        []string
 	cgofiles       []string
 	sfiles         []string
+	hfiles         []string
+	cxxfiles       []string
+	mfiles         []string
+	ffiles         []string
+	sysofiles      []string
+	swigfiles      []string
+	swigcxxfiles   []string
 	testgofiles    []string
 	xtestgofiles   []string
 	ignoredgofiles []string
@@ -115,6 +123,19 @@ var scanFilesTests = []struct {
 		xtestgofiles:   []string{"scanfiles_external_test.go"},
 		ignoredgofiles: []string{"doc.go"},
 	},
+	{path: "cgolangs",
+		cgofiles:  []string{"cgo.go"},
+		hfiles:    []string{"add.hpp"},
+		cxxfiles:  []string{"add.cc"},
+		mfiles:    []string{"hello.m"},
+		ffiles:    []string{"mul.f90"},
+		sysofiles: []string{"rsrc.syso"},
+	},
+	{path: "swig",
+		gofiles:      []string{"swig.go"},
+		swigfiles:    []string{"add.swig"},
+		swigcxxfiles: []string{"mul.swigcxx"},
+	},
 	{path: "stdlib/bytes",
 		gofiles:     []string{"buffer.go", "bytes.go", "bytes_decl.go", "reader.go"},
 		sfiles:      []string{"asm_" + runtime.GOARCH + ".s"},
@@ -138,6 +159,27 @@ func TestPackageScanFiles(t *testing.T) {
 		if !reflect.DeepEqual(tt.cgofiles, p.CgoFiles) {
 			t.Fatalf("pkg.CgoFiles: expected %q, got %q", tt.cgofiles, p.CgoFiles)
 		}
+		if !reflect.DeepEqual(tt.hfiles, p.HFiles) {
+			t.Fatalf("pkg.HFiles: expected %q, got %q", tt.hfiles, p.HFiles)
+		}
+		if !reflect.DeepEqual(tt.cxxfiles, p.CXXFiles) {
+			t.Fatalf("pkg.CXXFiles: expected %q, got %q", tt.cxxfiles, p.CXXFiles)
+		}
+		if !reflect.DeepEqual(tt.mfiles, p.MFiles) {
+			t.Fatalf("pkg.MFiles: expected %q, got %q", tt.mfiles, p.MFiles)
+		}
+		if !reflect.DeepEqual(tt.ffiles, p.FFiles) {
+			t.Fatalf("pkg.FFiles: expected %q, got %q", tt.ffiles, p.FFiles)
+		}
+		if !reflect.DeepEqual(tt.sysofiles, p.SysoFiles) {
+			t.Fatalf("pkg.SysoFiles: expected %q, got %q", tt.sysofiles, p.SysoFiles)
+		}
+		if !reflect.DeepEqual(tt.swigfiles, p.SwigFiles) {
+			t.Fatalf("pkg.SwigFiles: expected %q, got %q", tt.swigfiles, p.SwigFiles)
+		}
+		if !reflect.DeepEqual(tt.swigcxxfiles, p.SwigCXXFiles) {
+			t.Fatalf("pkg.SwigCXXFiles: expected %q, got %q", tt.swigcxxfiles, p.SwigCXXFiles)
+		}
 		if !reflect.DeepEqual(tt.testgofiles, p.TestGoFiles) {
 			t.Fatalf("pkg.TestGoFiles: expected %q, got %q", tt.testgofiles, p.TestGoFiles)
 		}
@@ -153,6 +195,12 @@ var resolvePackageErrorTests = []struct {
 }{
 	{"cgotest", "use of cgo in test cgo_test.go not supported"},
 	{"doublepkg", "found packages a (a.go) and b (b.go) in doublepkg"},
+	{"outer", "outer.go:3:8: use of internal package inner/internal/secret not allowed; only packages under inner may import it"},
+	{"internaltest", "internaltest_test.go:6:2: use of internal package inner/internal/secret not allowed; only packages under inner may import it"},
+	{"stdinternal", "stdinternal.go:3:8: use of internal package internal/race not allowed; only the standard library may import it"},
+	{"nocgocxx", "C++ source files not allowed when not using cgo or SWIG: add.cc"},
+	{"nocgoobjc", "Objective-C source files not allowed when not using cgo or SWIG: hello.m"},
+	{"nocgofortran", "Fortran source files not allowed when not using cgo or SWIG: mul.f90"},
 	{"blankimport", `blank.go:3:8: invalid import path: ""`},
 	{"empty", "no Go source files in empty"},
 	// {"empty2", "no Go source files in empty2/empty3"},
@@ -170,3 +218,97 @@ func TestResolvePackageError(t *testing.T) {
 		}
 	}
 }
+
+var resolvePackageOSArchTests = []struct {
+	goos, goarch string
+	gofiles      []string
+}{
+	{"linux", "amd64", []string{"osarch.go", "osarch_linux.go"}},
+	{"linux", "arm64", []string{"osarch.go", "osarch_arm64.go", "osarch_linux.go"}},
+	{"windows", "amd64", []string{"osarch.go", "osarch_windows.go", "osarch_windows_amd64.go"}},
+	{"windows", "386", []string{"osarch.go", "osarch_windows.go"}},
+	{"darwin", "amd64", []string{"darwin.go", "osarch.go"}},
+}
+
+func TestResolvePackageOSArch(t *testing.T) {
+	p := newProject(t)
+	for _, tt := range resolvePackageOSArchTests {
+		pkg, err := p.ResolvePackage(tt.goos, tt.goarch, "osarch").Result()
+		if err != nil {
+			t.Fatalf("Project.ResolvePackage(%q, %q, %q): %v", tt.goos, tt.goarch, "osarch", err)
+		}
+		if !reflect.DeepEqual(tt.gofiles, pkg.GoFiles) {
+			t.Errorf("Project.ResolvePackage(%q, %q, %q): pkg.GoFiles: expected %q, got %q", tt.goos, tt.goarch, "osarch", tt.gofiles, pkg.GoFiles)
+		}
+		pkg, err = p.ResolveFiles(tt.goos, tt.goarch, "osarch", []string{"osarch.go", "osarch_windows.go"}).Result()
+		if err != nil {
+			t.Fatalf("Project.ResolveFiles(%q, %q, %q): %v", tt.goos, tt.goarch, "osarch", err)
+		}
+		var want []string
+		for _, file := range tt.gofiles {
+			if file == "osarch.go" || file == "osarch_windows.go" {
+				want = append(want, file)
+			}
+		}
+		if !reflect.DeepEqual(want, pkg.GoFiles) {
+			t.Errorf("Project.ResolveFiles(%q, %q, %q): pkg.GoFiles: expected %q, got %q", tt.goos, tt.goarch, "osarch", want, pkg.GoFiles)
+		}
+	}
+}
+
+var resolveFilesTests = []struct {
+	path    string
+	files   []string
+	gofiles []string
+	err     bool
+}{
+	{path: "doublepkg", files: []string{"a.go"}, gofiles: []string{"a.go"}},
+	{path: "doublepkg", files: []string{"b.go"}, gofiles: []string{"b.go"}},
+	{path: "doublepkg", files: []string{"a.go", "b.go"}, err: true},
+	{path: "doublepkg", files: []string{"c.go"}, err: true},
+}
+
+func TestResolveFiles(t *testing.T) {
+	prj := newProject(t)
+	for _, tt := range resolveFilesTests {
+		p, err := prj.ResolveFiles(GOOS, GOARCH, tt.path, tt.files).Result()
+		if tt.err {
+			if err == nil {
+				t.Fatalf("ResolveFiles(%q, %q): expected error", tt.path, tt.files)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ResolveFiles(%q, %q): %v", tt.path, tt.files, err)
+		}
+		if !reflect.DeepEqual(tt.gofiles, p.GoFiles) {
+			t.Fatalf("pkg.GoFiles: expected %q, got %q", tt.gofiles, p.GoFiles)
+		}
+	}
+}
+
+func TestImportPos(t *testing.T) {
+	prj := newProject(t)
+	p, err := prj.ResolvePackage(GOOS, GOARCH, "a").Result()
+	if err != nil {
+		t.Fatalf("resolvepackage: %v", err)
+	}
+	// imports from the standard library are omitted from Imports,
+	// but their positions are recorded.
+	if len(p.Imports) != 0 {
+		t.Errorf("pkg.Imports: expected none, got %q", p.Imports)
+	}
+	for _, tt := range []struct {
+		pos  map[string][]token.Position
+		path string
+		want string
+	}{
+		{p.ImportPos, "fmt", "a1.go:3:8"},
+		{p.TestImportPos, "testing", "a_test.go:3:8"},
+	} {
+		pos := tt.pos[tt.path]
+		if len(pos) != 1 || pos[0].String() != tt.want {
+			t.Errorf("position of %q: expected %s, got %v", tt.path, tt.want, pos)
+		}
+	}
+}
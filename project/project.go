@@ -50,14 +50,26 @@ type Resolver interface {
 //					  the root of the project.
 // 	$PROJECT/src/			- base directory for the source of packages
 // 	$PROJECT/bin/			- base directory for the compiled binaries
+//
+// If $PROJECT contains a go.mod file the project is a module, the
+// packages of the project are found below $PROJECT, and their import
+// paths begin with the module path. Other imports are resolved from
+// the modules the go.mod file requires, see module.
 type Project struct {
 	root string
+	mod  *module // nil unless the project is a module
 
 	// SrcDirs represents the location of package sources.
 	SrcDirs []SrcDir
 
 	sync.Mutex // protects pkgs
-	pkgs       map[string]*pkgFuture
+	pkgs       map[pkgKey]*pkgFuture
+
+	envMu    sync.Mutex // protects override
+	config   map[string]string
+	override map[string]string
+
+	rules []Rule
 }
 
 // NewProject returns a *Project if root represents a valid gogo project.
@@ -71,11 +83,29 @@ func NewProject(root string) (*Project, error) {
 		// return nil, err
 	}
 
+	config, err := readConfig(filepath.Join(root, ".gogo", configFile))
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := readRules(filepath.Join(root, ".gogo", rulesFile))
+	if err != nil {
+		return nil, err
+	}
+
 	p := &Project{
-		root: root,
-		pkgs: make(map[string]*pkgFuture),
+		root:   root,
+		pkgs:   make(map[pkgKey]*pkgFuture),
+		config: config,
+		rules:  rules,
+	}
+	p.SrcDirs = []SrcDir{{p, "src", ""}}
+	if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+		if p.mod, err = readModule(root); err != nil {
+			return nil, err
+		}
+		p.SrcDirs = []SrcDir{{p, "", p.mod.file.Module}}
 	}
-	p.SrcDirs = []SrcDir{{p, "src"}}
 	return p, nil
 }
 
@@ -90,20 +120,53 @@ func (p *Project) Bindir() string { return filepath.Join(p.root, "bin") }
 type SrcDir struct {
 	project *Project
 	path    string
+	prefix  string // the import path of the directory, if any
 }
 
 func (s *SrcDir) SrcDir() string { return filepath.Join(s.project.root, s.path) }
 
 // Find resolves an import path to a source directory
 func (s *SrcDir) Find(path string) (string, error) {
-	dir := filepath.Join(s.SrcDir(), path)
+	rel, ok := inModule(s.prefix, path)
+	if s.prefix == "" {
+		rel, ok = path, true
+	}
+	if !ok {
+		return "", fmt.Errorf("import path %s is not inside %s", path, s.prefix)
+	}
+	dir := filepath.Join(s.SrcDir(), filepath.FromSlash(rel))
 	_, err := os.Stat(dir)
 	return dir, err
 }
 
+// ImportPath returns the import path of the package in dir, which
+// must be inside this SrcDir.
+func (s *SrcDir) ImportPath(dir string) (string, error) {
+	rel, err := filepath.Rel(s.SrcDir(), dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("directory %s is outside the project source directory %s", dir, s.SrcDir())
+	}
+	if rel == "." {
+		if s.prefix == "" {
+			return "", fmt.Errorf("directory %s is not a package directory", dir)
+		}
+		return s.prefix, nil
+	}
+	return joinPath(s.prefix, filepath.ToSlash(rel)), nil
+}
+
 // FindAdd returns the import paths of all the packages inside this SrcPath.
+// If the SrcDir is a module the root of the module is included, and
+// directories containing other modules, or named testdata, are omitted.
 func (s *SrcDir) FindAll() ([]string, error) {
-	return allPackages(s.SrcDir(), "")
+	if s.prefix == "" {
+		return allPackages(s.SrcDir(), "")
+	}
+	pkgs, err := allPackages(s.SrcDir(), s.prefix)
+	return append([]string{s.prefix}, pkgs...), err
 }
 
 func allPackages(dir, prefix string) ([]string, error) {
@@ -123,6 +186,13 @@ func allPackages(dir, prefix string) ([]string, error) {
 			continue
 		}
 		if f.IsDir() {
+			if name == "testdata" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, name, "go.mod")); err == nil {
+				// a nested module
+				continue
+			}
 			pkgs = append(pkgs, path.Join(prefix, name))
 			pp, err := allPackages(filepath.Join(dir, name), path.Join(prefix, name))
 			if err != nil {
@@ -134,28 +204,89 @@ func allPackages(dir, prefix string) ([]string, error) {
 	return pkgs, nil
 }
 
-// ResolvePackage resolves the import path to a Package.
+// pkgKey identifies a package directory scanned for a GOOS and GOARCH.
+type pkgKey struct {
+	goos, goarch, dir string
+}
+
+// ResolvePackage resolves the import path to a Package, considering
+// the files built for goos and goarch. The imports of the Package are
+// themselves resolved, so a vendored import is recorded under its
+// vendored path, see ImportMap. If import checking is enabled, a
+// Package whose imports violate the import rules of the project is
+// reported as an ImportRulesError.
 func (p *Project) ResolvePackage(goos, goarch, path string) *pkgFuture {
+	f := &pkgFuture{
+		result: make(chan result, 1),
+	}
+	pkg, err := p.newPackage(path)
+	if err != nil {
+		f.result <- result{pkg, err}
+		return f
+	}
 	p.Lock()
 	defer p.Unlock()
-	if f, ok := p.pkgs[path]; ok {
+	key := pkgKey{goos, goarch, pkg.Dir}
+	if f, ok := p.pkgs[key]; ok {
 		return f
 	}
-	pkg := &build.Package{
-		ImportPath: path,
-		SrcRoot:    filepath.Join(p.Root(), "src"),
-	}
+	go func() {
+		err := scanFiles(p.spec(goos, goarch), pkg)
+		if err == nil {
+			err = p.checkRules(pkg)
+		}
+		f.result <- result{pkg, err}
+	}()
+	p.pkgs[key] = f
+	return f
+}
+
+// ResolveFiles resolves the named files, which must be inside the
+// directory of the package with import path, to a Package.
+// Unlike ResolvePackage, the result is not cached.
+func (p *Project) ResolveFiles(goos, goarch, path string, files []string) *pkgFuture {
 	f := &pkgFuture{
 		result: make(chan result, 1),
 	}
+	pkg, err := p.newPackage(path)
+	if err != nil {
+		f.result <- result{pkg, err}
+		return f
+	}
 	go func() {
-		err := scanFiles(DefaultSpec(), pkg)
+		var fis []os.FileInfo
+		for _, file := range files {
+			fi, err := os.Stat(filepath.Join(pkg.Dir, file))
+			if err != nil {
+				f.result <- result{pkg, err}
+				return
+			}
+			fis = append(fis, fi)
+		}
+		err := scanFileList(p.spec(goos, goarch), pkg, fis)
 		f.result <- result{pkg, err}
 	}()
-	p.pkgs[path] = f
 	return f
 }
 
+// newPackage returns a Package for the import path, whose source has
+// not yet been scanned. If the project is a module, the directory of
+// the package is found with module.Dir, and SrcRoot is empty as the
+// package is not inside a GOPATH style source tree.
+func (p *Project) newPackage(path string) (*build.Package, error) {
+	pkg := &build.Package{
+		ImportPath: path,
+	}
+	if p.mod == nil {
+		pkg.SrcRoot = filepath.Join(p.Root(), "src")
+		pkg.Dir = filepath.Join(pkg.SrcRoot, filepath.FromSlash(path))
+		return pkg, nil
+	}
+	dir, err := p.mod.Dir(p.modCache(), path)
+	pkg.Dir = dir
+	return pkg, err
+}
+
 // scanFiles scans the Package recording all source files relevant to the
 // current Spec.
 func scanFiles(spec Spec, pkg *build.Package) error {
@@ -163,10 +294,15 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 	//	defer func() {
 	//		c.Record("scanFiles", time.Since(t0))
 	//	}()
-	files, err := ioutil.ReadDir(filepath.Join(pkg.SrcRoot, pkg.ImportPath))
+	files, err := ioutil.ReadDir(pkg.Dir)
 	if err != nil {
 		return err
 	}
+	return scanFileList(spec, pkg, files)
+}
+
+// scanFileList is like scanFiles but only considers the files listed.
+func scanFileList(spec Spec, pkg *build.Package, files []os.FileInfo) error {
 	imports := make(map[string]struct{})
 	testimports := make(map[string]struct{})
 	xtestimports := make(map[string]struct{})
@@ -194,6 +330,13 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 		switch ext {
 		case ".go", ".c", ".s", ".h", ".S", ".swig", ".swigcxx":
 			// tentatively okay - read to make sure
+		case ".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx", ".m", ".f", ".F", ".for", ".f90", ".F90":
+			// tentatively okay - read to make sure
+		case ".syso":
+			// binary objects are added to the package archive;
+			// they cannot contain +build comments.
+			pkg.SysoFiles = append(pkg.SysoFiles, filename)
+			continue
 		default:
 			// skip
 			continue
@@ -229,9 +372,24 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 		case ".c":
 			pkg.CFiles = append(pkg.CFiles, filename)
 			continue
-		case ".h":
+		case ".h", ".hh", ".hpp", ".hxx":
 			pkg.HFiles = append(pkg.HFiles, filename)
 			continue
+		case ".cc", ".cpp", ".cxx":
+			pkg.CXXFiles = append(pkg.CXXFiles, filename)
+			continue
+		case ".m":
+			pkg.MFiles = append(pkg.MFiles, filename)
+			continue
+		case ".f", ".F", ".for", ".f90", ".F90":
+			pkg.FFiles = append(pkg.FFiles, filename)
+			continue
+		case ".swig":
+			pkg.SwigFiles = append(pkg.SwigFiles, filename)
+			continue
+		case ".swigcxx":
+			pkg.SwigCXXFiles = append(pkg.SwigCXXFiles, filename)
+			continue
 		}
 
 		pf, err := parser.ParseFile(fset, filename, data, parser.ImportsOnly|parser.ParseComments)
@@ -257,7 +415,7 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 		} else if n != pkg.Name {
 			return fmt.Errorf("found packages %s (%s) and %s (%s) in %s", pkg.Name, firstFile, n, filename, pkg.ImportPath)
 		}
-		var isCgo bool
+		var isCgo, isEmbed bool
 		for _, decl := range pf.Decls {
 			switch decl := decl.(type) {
 			case *ast.GenDecl:
@@ -287,13 +445,34 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 							}
 							isCgo = true
 						default:
+							if path == "embed" {
+								isEmbed = true
+							}
+							if !spec.isStdlib(path) && pkg.SrcRoot != "" {
+								path = vendorPath(pkg.SrcRoot, pkg.ImportPath, path)
+							}
+							if parent, ok := internalAllowed(pkg.ImportPath, path, spec.isStdlib); !ok {
+								if parent == "" {
+									return fmt.Errorf("%s: use of internal package %s not allowed; only the standard library may import it", fset.Position(sp.Pos()), path)
+								}
+								return fmt.Errorf("%s: use of internal package %s not allowed; only packages under %s may import it", fset.Position(sp.Pos()), path, parent)
+							}
+							pos := &pkg.ImportPos
 							if isXTest {
 								xtestimports[path] = struct{}{}
+								pos = &pkg.XTestImportPos
 							} else if isTest {
 								testimports[path] = struct{}{}
+								pos = &pkg.TestImportPos
 							} else {
 								imports[path] = struct{}{}
 							}
+							// unlike Imports, the positions of imports
+							// from the standard library are recorded.
+							if *pos == nil {
+								*pos = make(map[string][]token.Position)
+							}
+							(*pos)[path] = append((*pos)[path], fset.Position(sp.Pos()))
 						}
 					default:
 						// skip
@@ -303,9 +482,24 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 				// skip
 			}
 		}
+		if isEmbed {
+			// //go:embed directives follow the imports, so the
+			// whole file must be parsed to find them.
+			pf, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, filename), nil, parser.ParseComments)
+			if err != nil {
+				return err
+			}
+			patterns, positions, err := embedDirectives(fset, pf)
+			if err != nil {
+				return err
+			}
+			addEmbedPatterns(pkg, patterns, positions, isTest, isXTest)
+		}
 		if isCgo {
 			if spec.cgoEnabled {
 				pkg.CgoFiles = append(pkg.CgoFiles, filename)
+			} else {
+				pkg.IgnoredGoFiles = append(pkg.IgnoredGoFiles, filename)
 			}
 		} else if isXTest {
 			pkg.XTestGoFiles = append(pkg.XTestGoFiles, filename)
@@ -318,22 +512,38 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 	if pkg.Name == "" {
 		return &build.NoGoError{pkg.ImportPath}
 	}
+	// C++, Objective-C and Fortran files are only compiled by cgo and
+	// SWIG; without them they would be silently ignored.
+	if len(pkg.CgoFiles) == 0 && len(pkg.SwigFiles) == 0 && len(pkg.SwigCXXFiles) == 0 {
+		for _, lang := range []struct {
+			name  string
+			files []string
+		}{
+			{"C++", pkg.CXXFiles},
+			{"Objective-C", pkg.MFiles},
+			{"Fortran", pkg.FFiles},
+		} {
+			if len(lang.files) > 0 {
+				return fmt.Errorf("%s source files not allowed when not using cgo or SWIG: %s", lang.name, strings.Join(lang.files, " "))
+			}
+		}
+	}
 	for i := range imports {
-		if stdlib[i] {
+		if spec.isStdlib(i) {
 			continue
 		}
 		pkg.Imports = append(pkg.Imports, i)
 	}
 
 	for i := range testimports {
-		if stdlib[i] {
+		if spec.isStdlib(i) {
 			continue
 		}
 		pkg.TestImports = append(pkg.TestImports, i)
 	}
 
 	for i := range xtestimports {
-		if stdlib[i] {
+		if spec.isStdlib(i) {
 			continue
 		}
 		pkg.XTestImports = append(pkg.XTestImports, i)
@@ -342,5 +552,5 @@ func scanFiles(spec Spec, pkg *build.Package) error {
 }
 
 func openFile(pkg *build.Package, name string) (io.ReadCloser, error) {
-	return os.Open(filepath.Join(pkg.SrcRoot, pkg.ImportPath, name))
+	return os.Open(filepath.Join(pkg.Dir, name))
 }
@@ -0,0 +1,204 @@
+package project
+
+// import layering rules
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"go/token"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rulesFile is the name of the import rules file, relative to the
+// .gogo directory.
+const rulesFile = "rules"
+
+// Rule constrains the imports of the packages matching From. An
+// import matching To is allowed, or denied, by the rule. Patterns are
+// import paths which may contain ... wildcards; a/... matches a and
+// every package below it.
+type Rule struct {
+	Allow    bool
+	From, To string
+	Line     int // the line of the rules file declaring the rule
+
+	from, to *regexp.Regexp // compiled From and To
+}
+
+func (r Rule) String() string {
+	verb := "deny"
+	if r.Allow {
+		verb = "allow"
+	}
+	return fmt.Sprintf("%s %s %s", verb, r.From, r.To)
+}
+
+// parseRules parses an import rules file. Each line of the file is
+// a rule,
+//
+//	deny app/domain/... app/http/...
+//	allow app/domain/... app/http/types
+//
+// blank lines and lines starting with # are ignored.
+func parseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 || (f[0] != "allow" && f[0] != "deny") {
+			return nil, fmt.Errorf("%s:%d: expected allow|deny FROM TO, got %q", rulesFile, n, line)
+		}
+		var re [2]*regexp.Regexp
+		for i, pattern := range f[1:] {
+			var err error
+			if re[i], err = compilePattern(pattern); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid pattern %q", rulesFile, n, pattern)
+			}
+		}
+		rules = append(rules, Rule{Allow: f[0] == "allow", From: f[1], To: f[2], Line: n, from: re[0], to: re[1]})
+	}
+	return rules, s.Err()
+}
+
+// readRules reads the import rules file at path.
+// A missing rules file is not an error.
+func readRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseRules(f)
+}
+
+// compilePattern returns the regular expression matching the import
+// paths matched by pattern.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	// a/... also matches a
+	if strings.HasSuffix(re, `/.*`) {
+		re = re[:len(re)-len(`/.*`)] + `(/.*)?`
+	}
+	return regexp.Compile(`^` + re + `$`)
+}
+
+// ImportViolation records an import which is denied by a Rule.
+type ImportViolation struct {
+	ImportPath string // the importing package
+	Import     string
+	Test       bool // the import is by a test of the package
+	Rule       Rule
+}
+
+func (v ImportViolation) Error() string {
+	kind := "import"
+	if v.Test {
+		kind = "test import"
+	}
+	return fmt.Sprintf("%s: %s of %s denied by %s:%d: %v", v.ImportPath, kind, v.Import, rulesFile, v.Rule.Line, v.Rule)
+}
+
+// ImportRulesError is returned when resolving a package whose imports
+// violate the import rules of the project.
+type ImportRulesError []ImportViolation
+
+func (e ImportRulesError) Error() string {
+	var msgs []string
+	for _, v := range e {
+		msgs = append(msgs, v.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Rules returns the import rules of the project, read from
+// $PROJECT/.gogo/rules.
+func (p *Project) Rules() []Rule { return p.rules }
+
+// CheckImports returns the imports of pkg, and of its tests, which
+// the import rules of the project deny. Of the rules matching an
+// import, the last one decides whether it is allowed; imports which
+// match no rule are allowed. Vendored imports also match the rules for
+// the import path in the source. Imports from the standard library, which
+// are omitted from Imports, are found in ImportPos, so rules may also
+// constrain them.
+func (p *Project) CheckImports(pkg *build.Package) []ImportViolation {
+	var violations []ImportViolation
+	for _, imports := range []struct {
+		list []string
+		pos  map[string][]token.Position
+		test bool
+	}{
+		{pkg.Imports, pkg.ImportPos, false},
+		{pkg.TestImports, pkg.TestImportPos, true},
+		{pkg.XTestImports, pkg.XTestImportPos, true},
+	} {
+		list := append([]string(nil), imports.list...)
+		for imp := range imports.pos {
+			if !contains(list, imp) {
+				list = append(list, imp)
+			}
+		}
+		sort.Strings(list)
+		for _, imp := range list {
+			var rule *Rule
+			for i := range p.rules {
+				r := &p.rules[i]
+				if r.from.MatchString(pkg.ImportPath) && r.matchImport(imp) {
+					rule = r
+				}
+			}
+			if rule != nil && !rule.Allow {
+				violations = append(violations, ImportViolation{
+					ImportPath: pkg.ImportPath,
+					Import:     imp,
+					Test:       imports.test,
+					Rule:       *rule,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// matchImport reports whether the import imp matches the To pattern
+// of r. A vendored import matches by either its vendored package path
+// or the import path in the source which resolved to it.
+func (r *Rule) matchImport(imp string) bool {
+	if r.to.MatchString(imp) {
+		return true
+	}
+	path, ok := unvendor(imp)
+	return ok && r.to.MatchString(path)
+}
+
+// CheckImportsEnabled reports whether the resolver rejects packages
+// which violate the import rules. Checking is enabled when
+// GOGO_CHECKIMPORTS is set to 1.
+func (p *Project) CheckImportsEnabled() bool {
+	return p.Getenv("GOGO_CHECKIMPORTS") == "1"
+}
+
+// checkRules returns an ImportRulesError if checking is enabled and
+// the imports of pkg violate the import rules.
+func (p *Project) checkRules(pkg *build.Package) error {
+	if !p.CheckImportsEnabled() {
+		return nil
+	}
+	if v := p.CheckImports(pkg); len(v) > 0 {
+		return ImportRulesError(v)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var compilePatternTests = []struct {
+	pattern, path string
+	want          bool
+}{
+	{"a", "a", true},
+	{"a", "a/b", false},
+	{"a/...", "a", true},
+	{"a/...", "a/b/c", true},
+	{"a/...", "ab", false},
+	{"a/.../c", "a/b/c", true},
+	{"a/.../c", "a/b/d", false},
+	{"...", "anything/at/all", true},
+	{"a.b/c", "axb/c", false},
+}
+
+func TestCompilePattern(t *testing.T) {
+	for _, tt := range compilePatternTests {
+		re, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compilePattern(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("compilePattern(%q).MatchString(%q): expected %v, got %v", tt.pattern, tt.path, tt.want, got)
+		}
+	}
+}
+
+var parseRulesTests = []struct {
+	data string
+	want []string // each rule, and its line
+	err  string
+}{{
+	data: "# comment\n\ndeny a/... b/...\n  allow a/x b/y  \n",
+	want: []string{
+		"3: deny a/... b/...",
+		"4: allow a/x b/y",
+	},
+}, {
+	data: "deny a\n",
+	err:  `rules:1: expected allow|deny FROM TO, got "deny a"`,
+}, {
+	data: "permit a b\n",
+	err:  `rules:1: expected allow|deny FROM TO, got "permit a b"`,
+}}
+
+func TestParseRules(t *testing.T) {
+	for _, tt := range parseRulesTests {
+		got, err := parseRules(strings.NewReader(tt.data))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseRules(%q): expected error %q, got %v", tt.data, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRules(%q): %v", tt.data, err)
+			continue
+		}
+		var rules []string
+		for _, r := range got {
+			rules = append(rules, fmt.Sprintf("%d: %v", r.Line, r))
+			if !r.from.MatchString(r.From) || !r.to.MatchString(r.To) {
+				t.Errorf("parseRules(%q): %v: patterns not compiled", tt.data, r)
+			}
+		}
+		if !reflect.DeepEqual(tt.want, rules) {
+			t.Errorf("parseRules(%q): expected %q, got %q", tt.data, tt.want, rules)
+		}
+	}
+}
+
+func TestCheckImports(t *testing.T) {
+	prj, err := NewProject(filepath.Join(root, "layers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, path := range []string{"app/domain", "app/http", "app/http/types", "app/model"} {
+		pkg, err := prj.ResolvePackage(GOOS, GOARCH, path).Result()
+		if err != nil {
+			t.Fatalf("ResolvePackage(%q): %v", path, err)
+		}
+		for _, v := range prj.CheckImports(pkg) {
+			got = append(got, v.Error())
+		}
+	}
+	want := []string{
+		"app/domain: import of net/http denied by rules:6: deny app/domain/... net/...",
+		"app/domain: test import of app/http denied by rules:2: deny app/domain/... app/http/...",
+		"app/http: import of app/vendor/github.com/x/orm denied by rules:8: deny app/http/... github.com/x/orm",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("CheckImports: expected %q, got %q", want, got)
+	}
+
+	// when enabled, the resolver rejects the package.
+	prj, err = NewProject(filepath.Join(root, "layers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prj.Setenv("GOGO_CHECKIMPORTS", "1")
+	if _, err := prj.ResolvePackage(GOOS, GOARCH, "app/domain").Result(); err == nil || err.Error() != strings.Join(want[:2], "\n") {
+		t.Errorf("ResolvePackage: expected error %q, got %v", strings.Join(want[:2], "\n"), err)
+	}
+	if _, err := prj.ResolvePackage(GOOS, GOARCH, "app/model").Result(); err != nil {
+		t.Errorf("ResolvePackage: %v", err)
+	}
+}
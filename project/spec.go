@@ -13,15 +13,20 @@ import (
 // Spec represents a build specification.
 type Spec struct {
 	goos, goarch, toolchain string
+	goroot                  string
 	buildTags, releaseTags  []string
 	cgoEnabled              bool
 }
 
 // DefaultSpec returns a Spec that represents this machine.
 func DefaultSpec() Spec {
-	return Spec{goos: runtime.GOOS, goarch: runtime.GOARCH, cgoEnabled: true}
+	return Spec{goos: runtime.GOOS, goarch: runtime.GOARCH, goroot: runtime.GOROOT(), cgoEnabled: true}
 }
 
+// isStdlib reports whether path is the import path of a package in
+// the standard library.
+func (ctxt *Spec) isStdlib(path string) bool { return isStdlib(ctxt.goroot, path) }
+
 // from $GOROOT/src/pkg/go/build/build.go
 
 // goodOSArchFile returns false if the name contains a $GOOS or $GOARCH
@@ -200,8 +205,8 @@ func (ctxt *Spec) shouldBuild(content []byte) bool {
 // from $GOROOT/src/pkg/go/build/build.go
 
 // saveCgo saves the information from the #cgo lines in the import "C" comment.
-// These lines set CFLAGS and LDFLAGS and pkg-config directives that affect
-// the way cgo's C code is built.
+// These lines set CFLAGS, CPPFLAGS, CXXFLAGS, FFLAGS, LDFLAGS and
+// pkg-config directives that affect the way cgo's C code is built.
 //
 // TODO(rsc): This duplicates code in cgo.
 // Once the dust settles, remove this code from cgo.
@@ -259,6 +264,12 @@ func (ctx *Spec) saveCgo(pkg *build.Package, filename string, cg *ast.CommentGro
 		switch verb {
 		case "CFLAGS":
 			pkg.CgoCFLAGS = append(pkg.CgoCFLAGS, args...)
+		case "CPPFLAGS":
+			pkg.CgoCPPFLAGS = append(pkg.CgoCPPFLAGS, args...)
+		case "CXXFLAGS":
+			pkg.CgoCXXFLAGS = append(pkg.CgoCXXFLAGS, args...)
+		case "FFLAGS":
+			pkg.CgoFFLAGS = append(pkg.CgoFFLAGS, args...)
 		case "LDFLAGS":
 			pkg.CgoLDFLAGS = append(pkg.CgoLDFLAGS, args...)
 		case "pkg-config":
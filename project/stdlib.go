@@ -1,5 +1,12 @@
 package project
 
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
 // packages from the standard lib. They are excluded
 // from the package map.
 
@@ -42,6 +49,7 @@ var stdlib = map[string]bool{
 	"debug/gosym":         true,
 	"debug/macho":         true,
 	"debug/pe":            true,
+	"embed":               true,
 	"encoding/ascii85":    true,
 	"encoding/asn1":       true,
 	"encoding/base32":     true,
@@ -135,3 +143,26 @@ var stdlib = map[string]bool{
 	"unicode/utf8":        true,
 	"unsafe":              true,
 }
+
+// IsStdlib reports whether path is the import path of a package in
+// the standard library.
+func IsStdlib(path string) bool { return isStdlib(runtime.GOROOT(), path) }
+
+// isStdlib reports whether path is the import path of a package in
+// the standard library of goroot. The list above predates packages
+// such as context and io/fs, so any other path whose first element
+// has no dot is looked for in $GOROOT/src.
+func isStdlib(goroot, path string) bool {
+	if stdlib[path] {
+		return true
+	}
+	elem := path
+	if i := strings.Index(elem, "/"); i >= 0 {
+		elem = elem[:i]
+	}
+	if goroot == "" || strings.Contains(elem, ".") {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(goroot, "src", filepath.FromSlash(path)))
+	return err == nil && fi.IsDir()
+}
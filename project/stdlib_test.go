@@ -0,0 +1,38 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsStdlib(t *testing.T) {
+	goroot, err := ioutil.TempDir("", "gogo-goroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(goroot)
+	for _, dir := range []string{"context", "io/fs", "example.com/lib"} {
+		if err := os.MkdirAll(filepath.Join(goroot, "src", filepath.FromSlash(dir)), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		goroot, path string
+		want         bool
+	}{
+		{goroot, "fmt", true},
+		{goroot, "context", true},
+		{goroot, "io/fs", true},
+		{"", "fmt", true},
+		{"", "context", false},
+		{goroot, "a", false},
+		{goroot, "example.com/lib", false}, // the first element has a dot
+	}
+	for _, tt := range tests {
+		if got := isStdlib(tt.goroot, tt.path); got != tt.want {
+			t.Errorf("isStdlib(%q, %q): expected %t, got %t", tt.goroot, tt.path, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package project
+
+// vendor directory support
+
+import (
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// vendorPath returns the import path which satisfies the import of
+// path by the package importer. The vendor directories on the path
+// from importer up to srcroot are searched, innermost first. If none
+// of them contains path, path is returned.
+func vendorPath(srcroot, importer, path string) string {
+	for dir := importer; ; dir = parentPath(dir) {
+		vendored := joinPath(dir, "vendor", path)
+		if fi, err := os.Stat(filepath.Join(srcroot, filepath.FromSlash(vendored))); err == nil && fi.IsDir() {
+			return vendored
+		}
+		if dir == "" {
+			return path
+		}
+	}
+}
+
+// parentPath returns the parent of the import path p, or "" if p
+// is at the root of the source tree.
+func parentPath(p string) string {
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+func joinPath(elem ...string) string {
+	return strings.TrimPrefix(path.Join(elem...), "/")
+}
+
+// unvendor returns the import path which was resolved to the vendored
+// package path, and whether path is vendored.
+func unvendor(path string) (string, bool) {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):], true
+	}
+	if strings.HasPrefix(path, "vendor/") {
+		return path[len("vendor/"):], true
+	}
+	return "", false
+}
+
+// ImportMap returns a map from the import paths used in the source of
+// pkg to the vendored packages which satisfied them. Imports which
+// were not satisfied by a vendor directory are omitted.
+func ImportMap(pkg *build.Package) map[string]string {
+	m := make(map[string]string)
+	for _, imports := range [][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+		for _, imp := range imports {
+			if path, ok := unvendor(imp); ok {
+				m[path] = imp
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,55 @@
+package project
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var vendorPathTests = []struct {
+	importer, path string
+	want           string
+}{
+	{"vend/app", "lib", "vend/app/vendor/lib"},
+	{"vend/app", "shared", "vend/vendor/shared"},
+	{"vend/app", "a", "a"},
+	{"vend/app/vendor/lib", "lib/internal/x", "vend/app/vendor/lib/internal/x"},
+	{"vend", "lib", "lib"},
+	{"a", "shared", "shared"},
+}
+
+func TestVendorPath(t *testing.T) {
+	srcroot := filepath.Join(root, "src")
+	for _, tt := range vendorPathTests {
+		if got := vendorPath(srcroot, tt.importer, tt.path); got != tt.want {
+			t.Errorf("vendorPath(%q, %q): expected %q, got %q", tt.importer, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestResolveVendoredImports(t *testing.T) {
+	prj := newProject(t)
+	p, err := prj.ResolvePackage(GOOS, GOARCH, "vend/app").Result()
+	if err != nil {
+		t.Fatalf("resolvepackage: %v", err)
+	}
+	imports := append([]string{}, p.Imports...)
+	sort.Strings(imports)
+	if want := []string{"a", "vend/app/vendor/lib", "vend/vendor/shared"}; !reflect.DeepEqual(want, imports) {
+		t.Errorf("pkg.Imports: expected %q, got %q", want, imports)
+	}
+	want := map[string]string{"lib": "vend/app/vendor/lib", "shared": "vend/vendor/shared"}
+	if got := ImportMap(p); !reflect.DeepEqual(want, got) {
+		t.Errorf("ImportMap: expected %q, got %q", want, got)
+	}
+
+	// internal packages of vendored packages are visible to them.
+	lib, err := prj.ResolvePackage(GOOS, GOARCH, "vend/app/vendor/lib").Result()
+	if err != nil {
+		t.Fatalf("resolvepackage: %v", err)
+	}
+	if want := []string{"vend/app/vendor/lib/internal/x"}; !reflect.DeepEqual(want, lib.Imports) {
+		t.Errorf("pkg.Imports: expected %q, got %q", want, lib.Imports)
+	}
+}
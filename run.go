@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	gobuild "go/build"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/davecheney/gogo/build"
+	"github.com/davecheney/gogo/log"
+	"github.com/davecheney/gogo/project"
+)
+
+func init() {
+	registerCommand("run", RunCmd)
+}
+
+// exitStatus is returned by a command to request that gogo exits
+// with a particular status code.
+type exitStatus int
+
+func (e exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+var RunCmd = &Command{
+	Run: func(proj *project.Project, args []string) (err error) {
+		ctx, err := newContext(proj)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if derr := destroyContext(ctx, err); err == nil {
+				err = derr
+			}
+		}()
+		var gofiles []string
+		for len(args) > 0 && strings.HasSuffix(args[0], ".go") {
+			gofiles = append(gofiles, args[0])
+			args = args[1:]
+		}
+		var pkg *gobuild.Package
+		if len(gofiles) > 0 {
+			pkg, err = resolveFiles(proj, gofiles)
+		} else {
+			pkg, err = resolveRunPackage(proj, ctx, args[0])
+			args = args[1:]
+		}
+		if err != nil {
+			return err
+		}
+		if pkg.Name != "main" {
+			return fmt.Errorf("package %q is not a command", pkg.ImportPath)
+		}
+
+		stop := cancelOnInterrupt(ctx)
+		err = build.Build(ctx, pkg).Result()
+		stop()
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(build.Binfile(ctx, pkg), args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		ctx.Print(cmd)
+		if N {
+			return nil
+		}
+		return runCommand(cmd)
+	},
+	AddFlags: addBuildFlags,
+}
+
+// resolveRunPackage resolves the package named by arg.
+func resolveRunPackage(proj *project.Project, ctx *build.Context, arg string) (*gobuild.Package, error) {
+	if arg == "." {
+		var err error
+		arg, err = proj.SrcDirs[0].ImportPath(mustGetwd())
+		if err != nil {
+			return nil, err
+		}
+	}
+	pkg, err := ctx.ResolvePackage(*goos, *goarch, arg).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve package %q: %v", arg, err)
+	}
+	return pkg, nil
+}
+
+// resolveFiles resolves a list of .go files, which must all be in
+// the same directory, to a Package.
+func resolveFiles(proj *project.Project, gofiles []string) (*gobuild.Package, error) {
+	var dir string
+	var names []string
+	for _, file := range gofiles {
+		if strings.HasSuffix(file, "_test.go") {
+			return nil, fmt.Errorf("cannot run test file %q", file)
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			dir = filepath.Dir(abs)
+		} else if dir != filepath.Dir(abs) {
+			return nil, fmt.Errorf("named files must all be in one directory; have %s and %s", dir, filepath.Dir(abs))
+		}
+		names = append(names, filepath.Base(abs))
+	}
+	path, err := proj.SrcDirs[0].ImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := proj.ResolveFiles(*goos, *goarch, path, names).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve files %q: %v", gofiles, err)
+	}
+	return pkg, nil
+}
+
+// runCommand runs cmd, forwarding any SIGTERM or SIGHUP gogo receives,
+// and returns an exitStatus if cmd exits unsuccessfully. SIGINT and
+// SIGQUIT from the terminal already reach cmd, which is in the same
+// process group, so gogo only ignores them while cmd runs.
+func runCommand(cmd *exec.Cmd) error {
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, os.Interrupt, syscall.SIGQUIT)
+	defer signal.Stop(ignored)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				log.Debugf("forwarding %v to %s", sig, cmd.Path)
+				cmd.Process.Signal(sig)
+			case <-ignored:
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := cmd.Wait()
+	if err, ok := err.(*exec.ExitError); ok {
+		if status, ok := err.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return exitStatus(128 + int(status.Signal()))
+			}
+			return exitStatus(status.ExitStatus())
+		}
+	}
+	return err
+}
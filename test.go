@@ -1,11 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	gobuild "go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
 
 	"github.com/davecheney/gogo/build"
+	"github.com/davecheney/gogo/cover"
 	"github.com/davecheney/gogo/log"
 	"github.com/davecheney/gogo/project"
 	"github.com/davecheney/gogo/test"
@@ -15,44 +25,355 @@ func init() {
 	registerCommand("test", TestCmd)
 }
 
+var (
+	// test flags
+
+	// should we collect coverage information ?
+	Cover bool
+
+	// the coverage mode, set, count, or atomic.
+	CoverMode string
+
+	// where to write the merged coverage profile, and reports.
+	CoverProfile, CoverHTML, CoverXML string
+
+	// the number of test binaries to run in parallel.
+	P int
+
+	// should we build the test binaries without running them ?
+	C bool
+
+	// where to write the test binaries built with -c.
+	O string
+
+	// the number of times to run each test; disables the test cache.
+	Count int
+
+	// should we print test events as JSON ?
+	JSON bool
+
+	// where to write a JUnit XML report.
+	JUnit string
+)
+
+func addTestFlags(fs *flag.FlagSet) {
+	addBuildFlags(fs)
+	fs.BoolVar(&C, "c", false, "build the test binaries, but do not run them")
+	fs.StringVar(&O, "o", "", "write the test binary to this file or directory; implies -c")
+	fs.IntVar(&P, "p", runtime.NumCPU(), "the number of test binaries to build or run in parallel")
+	fs.IntVar(&Count, "count", 0, "run each test this many times; bypasses the test cache")
+	fs.BoolVar(&JSON, "json", false, "print test events as JSON")
+	fs.StringVar(&JUnit, "junit", "", "write a JUnit XML report to this file")
+	fs.BoolVar(&Cover, "cover", false, "enable coverage analysis")
+	fs.StringVar(&CoverMode, "covermode", "", "coverage mode: set, count, or atomic; implies -cover")
+	fs.StringVar(&CoverProfile, "coverprofile", "", "write a merged coverage profile to this file; implies -cover")
+	fs.StringVar(&CoverHTML, "coverhtml", "", "write an HTML coverage report to this file; implies -cover")
+	fs.StringVar(&CoverXML, "coverxml", "", "write a Cobertura XML coverage report to this file; implies -cover")
+}
+
+// newTestContext returns a test.Context configured from the command line flags.
+func newTestContext(proj *project.Project, ctx *build.Context) *test.Context {
+	tctx := test.NewContext(ctx)
+	tctx.Parallel = P
+	tctx.Count = Count
+	tctx.Cache = filepath.Join(proj.Root(), projectdir, "cache", "test")
+	tctx.Verbose = log.Verbose || JSON || JUnit != ""
+	tctx.Cover = Cover || CoverMode != "" || CoverProfile != "" || CoverHTML != "" || CoverXML != ""
+	if CoverMode != "" {
+		tctx.CoverMode = CoverMode
+	}
+	return tctx
+}
+
 var TestCmd = &Command{
-	Run: func(proj *project.Project, args []string) error {
-		ctx, err := build.NewContext(proj, *toolchain, *goroot, *goos, *goarch)
+	Run: func(proj *project.Project, args []string) (err error) {
+		ctx, err := newContext(proj)
 		if err != nil {
 			return err
 		}
-		var pkgs []*gobuild.Package
-		if A {
-			var err error
-			args, err = proj.SrcDirs[0].FindAll()
-			if err != nil {
-				return fmt.Errorf("could not fetch packages in srcpath %v: %v", proj.SrcDirs[0], err)
+		defer func() {
+			if derr := destroyContext(ctx, err); err == nil {
+				err = derr
 			}
+		}()
+		defer cancelOnInterrupt(ctx)()
+		tctx := newTestContext(proj, ctx)
+		pkgs, err := resolvePackages(proj, args)
+		if err != nil {
+			return err
+		}
+		if C || O != "" {
+			return compileTests(tctx, pkgs)
 		}
-		for _, arg := range args {
-			if arg == "." {
-				var err error
-				arg, err = filepath.Rel(proj.SrcDirs[0].SrcDir(), mustGetwd())
-				if err != nil {
-					return err
+		results := make([]test.Future, len(pkgs))
+		for i, pkg := range pkgs {
+			results[i] = test.Test(tctx, pkg)
+		}
+		var failed int
+		var events []test.Event
+		var firstErr error
+		for i, result := range results {
+			err := result.Result()
+			if JSON || JUnit != "" {
+				e := testEvents(pkgs[i], result, err)
+				if JSON {
+					if err := writeEvents(os.Stdout, e); err != nil {
+						return err
+					}
 				}
+				events = append(events, e...)
+			}
+			if !JSON {
+				printTestResult(pkgs[i], result, err)
 			}
-			pkg, err := ctx.ResolvePackage("linux", "amd64", arg).Result()
 			if err != nil {
-				if _, ok := err.(*gobuild.NoGoError); ok {
-					log.Debugf("skipping %q", arg)
-					continue
+				failed++
+				if !K {
+					ctx.Cancel()
+					firstErr = err
+					break
 				}
-				return fmt.Errorf("failed to resolve package %q: %v", arg, err)
 			}
-			pkgs = append(pkgs, pkg)
 		}
-		for _, pkg := range pkgs {
-			if err := test.Test(ctx, pkg).Result(); err != nil {
+		if JUnit != "" {
+			if err := writeJUnit(JUnit, events); err != nil {
+				return err
+			}
+		}
+		if firstErr != nil {
+			return firstErr
+		}
+		if tctx.Cover && !N {
+			if err := writeCoverReports(tctx, proj, pkgs); err != nil {
 				return err
 			}
 		}
-		return ctx.Destroy()
+		if failed > 0 {
+			return fmt.Errorf("%d of %d packages failed", failed, len(pkgs))
+		}
+		return nil
 	},
-	AddFlags: addBuildFlags,
+	AddFlags: addTestFlags,
+}
+
+// resolvePackages resolves the packages named by args, or every
+// package in the project if -a is set, sorted by import path.
+// Directories without Go files are skipped.
+func resolvePackages(proj *project.Project, args []string) ([]*gobuild.Package, error) {
+	if A {
+		var err error
+		args, err = proj.SrcDirs[0].FindAll()
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch packages in srcpath %v: %v", proj.SrcDirs[0], err)
+		}
+	}
+	var pkgs []*gobuild.Package
+	for _, arg := range args {
+		if arg == "." {
+			var err error
+			arg, err = proj.SrcDirs[0].ImportPath(mustGetwd())
+			if err != nil {
+				return nil, err
+			}
+		}
+		pkg, err := proj.ResolvePackage(*goos, *goarch, arg).Result()
+		if err != nil {
+			if _, ok := err.(*gobuild.NoGoError); ok {
+				log.Debugf("skipping %q", arg)
+				continue
+			}
+			return nil, fmt.Errorf("failed to resolve package %q: %v", arg, err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Sort(byImportPath(pkgs))
+	return pkgs, nil
+}
+
+// compileTests builds the test binary for each of pkgs, without
+// running it, and writes it to the current directory or to -o.
+func compileTests(ctx *test.Context, pkgs []*gobuild.Package) error {
+	dsts, err := testBinaryPaths(pkgs, mustGetwd(), O, ctx.GOOS())
+	if err != nil {
+		return err
+	}
+	results := make([]build.Future, len(pkgs))
+	for i, pkg := range pkgs {
+		results[i] = test.Binary(ctx, pkg, dsts[i])
+	}
+	var failed int
+	for i, result := range results {
+		if err := result.Result(); err != nil {
+			fmt.Printf("FAIL\t%s [build failed]\n", pkgs[i].ImportPath)
+			failed++
+			if !K {
+				ctx.Cancel()
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test binaries failed to build", failed, len(pkgs))
+	}
+	return nil
+}
+
+// testBinaryPaths returns the paths the test binaries of pkgs, built
+// for goos, are written to. The binaries are written to wd unless o is
+// set, in which case o must name a directory, or, if there is a single
+// package, the file to write.
+func testBinaryPaths(pkgs []*gobuild.Package, wd, o, goos string) ([]string, error) {
+	dir, file := wd, ""
+	if o != "" {
+		if fi, err := os.Stat(o); err == nil && fi.IsDir() {
+			dir = o
+		} else if len(pkgs) > 1 {
+			return nil, fmt.Errorf("with multiple packages, -o must refer to a directory")
+		} else {
+			file = o
+		}
+	}
+	var dsts []string
+	for _, pkg := range pkgs {
+		dst := file
+		if dst == "" {
+			dst = filepath.Join(dir, testBinaryName(pkg, goos))
+		}
+		dsts = append(dsts, dst)
+	}
+	return dsts, nil
+}
+
+// testBinaryName returns the file name of the test binary for pkg
+// built for goos.
+func testBinaryName(pkg *gobuild.Package, goos string) string {
+	name := path.Base(pkg.ImportPath) + ".test"
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// testEvents returns the events for the test of pkg. If the test
+// binary could not be built, a failure of the package is reported.
+func testEvents(pkg *gobuild.Package, result test.Future, err error) []test.Event {
+	if err != nil {
+		if _, ok := err.(*test.Failure); !ok {
+			now := time.Now()
+			return []test.Event{
+				{Time: now, Action: "output", Package: pkg.ImportPath, Output: fmt.Sprintf("FAIL\t%s [build failed]\n", pkg.ImportPath)},
+				{Time: now, Action: "fail", Package: pkg.ImportPath},
+			}
+		}
+	}
+	return test.Events(pkg.ImportPath, result.Output(), result.Elapsed(), err != nil)
+}
+
+// writeEvents writes events to w, one JSON object per line.
+func writeEvents(w io.Writer, events []test.Event) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJUnit writes a JUnit XML report of events to the named file.
+func writeJUnit(file string, events []test.Event) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := test.WriteJUnit(f, events); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %q: %v", file, err)
+	}
+	return f.Close()
+}
+
+// printTestResult prints the output of the test binary for pkg, if
+// it failed or -v is set, followed by a summary line.
+func printTestResult(pkg *gobuild.Package, result test.Future, err error) {
+	if err == nil {
+		if log.Verbose {
+			os.Stdout.Write(result.Output())
+		}
+		if result.Cached() {
+			fmt.Printf("ok  \t%s\t(cached)\n", pkg.ImportPath)
+			return
+		}
+		fmt.Printf("ok  \t%s\t%.3fs\n", pkg.ImportPath, result.Elapsed().Seconds())
+		return
+	}
+	if _, ok := err.(*test.Failure); !ok {
+		fmt.Printf("FAIL\t%s [build failed]\n", pkg.ImportPath)
+		return
+	}
+	os.Stdout.Write(result.Output())
+	fmt.Printf("FAIL\t%s\t%.3fs\n", pkg.ImportPath, result.Elapsed().Seconds())
+}
+
+type byImportPath []*gobuild.Package
+
+func (p byImportPath) Len() int           { return len(p) }
+func (p byImportPath) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byImportPath) Less(i, j int) bool { return p[i].ImportPath < p[j].ImportPath }
+
+// writeCoverReports merges the coverage profiles of the tested
+// packages, prints a summary, and writes the requested reports.
+func writeCoverReports(ctx *test.Context, proj *project.Project, pkgs []*gobuild.Package) error {
+	var profiles []*cover.Profile
+	for _, pkg := range pkgs {
+		f, err := os.Open(test.CoverProfile(ctx, pkg))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// tests failed to build or run
+				continue
+			}
+			return err
+		}
+		p, err := cover.ParseProfiles(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("could not parse coverage profile for %q: %v", pkg.ImportPath, err)
+		}
+		profiles = append(profiles, p...)
+	}
+	profiles = cover.Merge(profiles)
+	if err := cover.WriteText(os.Stdout, profiles); err != nil {
+		return err
+	}
+	srcdir := proj.SrcDirs[0].SrcDir()
+	reports := []struct {
+		file  string
+		write func(io.Writer) error
+	}{
+		{CoverProfile, func(w io.Writer) error { return cover.WriteProfile(w, profiles) }},
+		{CoverHTML, func(w io.Writer) error {
+			return cover.WriteHTML(w, profiles, func(name string) ([]byte, error) {
+				return ioutil.ReadFile(filepath.Join(srcdir, filepath.FromSlash(name)))
+			})
+		}},
+		{CoverXML, func(w io.Writer) error { return cover.WriteCobertura(w, profiles, srcdir) }},
+	}
+	for _, r := range reports {
+		if r.file == "" {
+			continue
+		}
+		f, err := os.Create(r.file)
+		if err != nil {
+			return err
+		}
+		if err := r.write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("could not write %q: %v", r.file, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.Infof("wrote coverage report %q", r.file)
+	}
+	return nil
 }
@@ -0,0 +1,179 @@
+package test
+
+// test result caching
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	gobuild "go/build"
+	"go/parser"
+	"go/token"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davecheney/gogo/build"
+)
+
+// cacheEnv lists the environment variables which are always
+// considered to affect the result of a test.
+var cacheEnv = []string{"GOROOT", "GOPATH", "GOOS", "GOARCH", "GOMAXPROCS", "GODEBUG", "GOGC", "GOTRACEBACK"}
+
+// cacheable reports whether the result of the test may be cached.
+func (t *runTestTarget) cacheable() bool {
+	return t.Cache != "" && t.Count == 0 && t.Bench == "" && !t.Cover && !t.DryRun
+}
+
+// cacheKey returns the key under which the result of running the test
+// binary with args is stored. The binary itself is not hashed, as it
+// records the work directory it was linked in, which differs on each
+// run. Instead the key covers the inputs the binary is built from: the
+// package under test, its tests and their dependencies, see
+// build.PackageKey, and the generated test main. It also covers the
+// arguments, the environment variables the tests read, and the files
+// in the package directory, which the tests may open.
+func (t *runTestTarget) cacheKey(args []string) (string, error) {
+	h := sha256.New()
+	key, err := build.PackageKey(t.Context.Context, t.Package)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "package %s\n", key)
+	if err := hashFile(h, filepath.Join(objdir(t.Context, t.Package), "_testmain.go")); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "args %q\n", args)
+	vars, err := envVars(t.Package)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range vars {
+		value, ok := os.LookupEnv(v)
+		fmt.Fprintf(h, "env %s %t %q\n", v, ok, value)
+	}
+	if err := hashTree(h, t.Srcdir()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// readCache returns the output stored under key, or false if there
+// is no entry for key.
+func (t *runTestTarget) readCache(key string) ([]byte, bool) {
+	output, err := ioutil.ReadFile(filepath.Join(t.Cache, key))
+	if err != nil {
+		return nil, false
+	}
+	return output, true
+}
+
+// writeCache stores output under key.
+func (t *runTestTarget) writeCache(key string, output []byte) error {
+	if err := os.MkdirAll(t.Cache, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(t.Cache, key)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(output); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(t.Cache, key))
+}
+
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// hashTree adds the names and contents of the files below dir to h.
+// Files and directories whose names begin with . or _ are skipped.
+func hashTree(h hash.Hash, dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := fi.Name()
+		if path != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "file %q %d\n", filepath.ToSlash(rel), fi.Size())
+		return hashFile(h, path)
+	})
+}
+
+// envVars returns the environment variables which may affect the
+// tests of pkg. In addition to cacheEnv, any variable named by a
+// string literal passed to os.Getenv or os.LookupEnv in the source of
+// pkg or its tests is included.
+func envVars(pkg *gobuild.Package) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, v := range cacheEnv {
+		seen[v] = true
+	}
+	var files []string
+	files = append(files, pkg.GoFiles...)
+	files = append(files, pkg.CgoFiles...)
+	files = append(files, pkg.TestGoFiles...)
+	files = append(files, pkg.XTestGoFiles...)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Getenv" && sel.Sel.Name != "LookupEnv") {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "os" {
+				return true
+			}
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if v, err := strconv.Unquote(lit.Value); err == nil {
+					seen[v] = true
+				}
+			}
+			return true
+		})
+	}
+	var vars []string
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars, nil
+}
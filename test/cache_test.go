@@ -0,0 +1,134 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/davecheney/gogo/build"
+	"github.com/davecheney/gogo/project"
+)
+
+var cacheTests = []struct {
+	edit   bool // modify the source of the package before the run
+	count  int
+	cached bool
+}{
+	{false, 0, false}, // the first run
+	{false, 0, true},  // replays the first run
+	{true, 0, false},  // the source has changed
+	{false, 0, true},
+	{false, 1, false}, // -count=1 bypasses the cache
+}
+
+// TestCache runs a fake test binary, which records each run, in a new
+// work directory each time, as gogo test does. Like a real test binary,
+// the fake records the work directory it was built in.
+func TestCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake test binary is a shell script")
+	}
+	tmp, err := ioutil.TempDir("", "gogo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for file, data := range map[string]string{
+		"src/a/a.go":      "package a\n",
+		"src/a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n",
+	} {
+		path := filepath.Join(tmp, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs := filepath.Join(tmp, "runs")
+	want := 0
+	for i, tt := range cacheTests {
+		if tt.edit {
+			if err := ioutil.WriteFile(filepath.Join(tmp, "src", "a", "a.go"), []byte("package a\n\nconst A = 1\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p, err := project.NewProject(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bctx, err := build.NewDefaultContext(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bctx.Destroy()
+		ctx := NewContext(bctx)
+		ctx.Cache = filepath.Join(tmp, "cache")
+		ctx.Count = tt.count
+		pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "a").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		objdir := objdir(ctx, pkg)
+		if err := os.MkdirAll(objdir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(objdir, "_testmain.go"), []byte("package main\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		binary := "#!/bin/sh\n# " + ctx.Workdir() + "\necho run >> " + runs + "\necho PASS\n"
+		if err := ioutil.WriteFile(testBinary(ctx, pkg), []byte(binary), 0777); err != nil {
+			t.Fatal(err)
+		}
+		f := runTest(ctx, pkg)
+		if err := f.Result(); err != nil {
+			t.Fatalf("%d: runTest: %v", i, err)
+		}
+		if got := f.Cached(); got != tt.cached {
+			t.Errorf("%d: Cached: expected %t, got %t", i, tt.cached, got)
+		}
+		if got := string(f.Output()); got != "PASS\n" {
+			t.Errorf("%d: Output: expected %q, got %q", i, "PASS\n", got)
+		}
+		if !tt.cached {
+			want++
+		}
+		data, err := ioutil.ReadFile(runs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "run\n"); got != want {
+			t.Errorf("%d: expected the test binary to have run %d times, got %d", i, want, got)
+		}
+	}
+}
+
+// TestCacheBuild runs the tests of a package twice, each time building
+// the test binary in a new work directory, as gogo test does, and
+// checks that the second run is replayed from the cache.
+func TestCacheBuild(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for i, cached := range []bool{false, true} {
+		ctx := newTestContext(t)
+		defer ctx.Destroy()
+		ctx.Cache = tmp
+		pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "a").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := Test(ctx, pkg)
+		if err := f.Result(); err != nil {
+			t.Fatalf("%d: Test: %v", i, err)
+		}
+		if got := f.Cached(); got != cached {
+			t.Errorf("%d: Cached: expected %t, got %t", i, cached, got)
+		}
+	}
+}
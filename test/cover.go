@@ -0,0 +1,93 @@
+package test
+
+// test coverage
+
+import (
+	"bytes"
+	"fmt"
+	gobuild "go/build"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/davecheney/gogo/build"
+	"github.com/davecheney/gogo/cover"
+	"github.com/davecheney/gogo/log"
+)
+
+// coverVar describes the coverage counters added to a source file.
+type coverVar struct {
+	File    string // name of the source file
+	Var     string // name of the counter variable
+	Profile string // name of the file as reported in the coverage profile
+}
+
+// coverVars returns the coverage counters for the GoFiles of pkg.
+func coverVars(pkg *gobuild.Package) []coverVar {
+	var vars []coverVar
+	for i, file := range pkg.GoFiles {
+		vars = append(vars, coverVar{
+			File:    file,
+			Var:     fmt.Sprintf("GoCover_%d", i),
+			Profile: path.Join(pkg.ImportPath, file),
+		})
+	}
+	return vars
+}
+
+// CoverProfile returns the path of the coverage profile written when
+// the tests for pkg are run with coverage enabled.
+func CoverProfile(ctx *Context, pkg *gobuild.Package) string {
+	return filepath.Join(testobjdir(ctx, pkg), "cover.out")
+}
+
+// coverTarget implements a build.Future that represents adding
+// coverage counters to the source of a package.
+type coverTarget struct {
+	target
+	vars []coverVar
+}
+
+func (t *coverTarget) execute() {
+	if err := t.WaitDeps(); err != nil {
+		t.err <- err
+		return
+	}
+	log.Debugf("cover %q: %s", t.ImportPath, t.GoFiles)
+	t.err <- t.build()
+}
+
+func (t *coverTarget) build() error {
+	t0 := time.Now()
+	defer func() { t.Record("cover", time.Since(t0)) }()
+	dir := testobjdir(t.Context, t.Package)
+	if err := t.Mkdir(dir); err != nil {
+		return err
+	}
+	for _, v := range t.vars {
+		src, err := ioutil.ReadFile(filepath.Join(t.Srcdir(), v.File))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := cover.Annotate(&buf, src, v.File, v.Var, t.CoverMode); err != nil {
+			return err
+		}
+		if err := t.WriteFile(filepath.Join(dir, v.File), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverPackage returns a Future representing the result of adding
+// coverage counters to the files of pkg described by vars.
+func coverPackage(ctx *Context, pkg *gobuild.Package, vars []coverVar) build.Future {
+	t := &coverTarget{
+		target: newTarget(ctx, pkg),
+		vars:   vars,
+	}
+	go t.execute()
+	return t
+}
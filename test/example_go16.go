@@ -0,0 +1,10 @@
+// +build !go1.7
+
+package test
+
+import "go/doc"
+
+// unordered reports whether the output of e may appear in any order.
+// go/doc only recognises unordered output from Go 1.7; whether the
+// testing package in GOROOT supports it is recorded in testingAPI.
+func unordered(e *doc.Example) bool { return false }
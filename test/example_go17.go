@@ -0,0 +1,8 @@
+// +build go1.7
+
+package test
+
+import "go/doc"
+
+// unordered reports whether the output of e may appear in any order.
+func unordered(e *doc.Example) bool { return e.Unordered }
@@ -9,12 +9,13 @@ package test
 // imported from $GOROOT/src/cmd/go/test.go
 
 import (
+	"errors"
 	"go/ast"
 	"go/build"
 	"go/doc"
 	"go/parser"
 	"go/token"
-	"os"
+	"io"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -36,30 +37,27 @@ func isTest(name, prefix string) bool {
 	return !unicode.IsLower(rune)
 }
 
-// writeTestmain writes the _testmain.go file for package p to
-// the file named out.
-func writeTestmain(out string, p *build.Package) error {
+// writeTestmain writes the _testmain.go file for package p to w.
+// Coverage is not supported before Go 1.1, so cover must be empty.
+func writeTestmain(w io.Writer, p *build.Package, _ testingAPI, cover []coverVar, _ string) error {
+	if len(cover) > 0 {
+		return errors.New("coverage requires Go 1.1 or later")
+	}
 	t := &testFuncs{
 		Package: p,
 	}
 	for _, file := range p.TestGoFiles {
-		if err := t.load(filepath.Join(p.SrcRoot, p.ImportPath, file), "_test", &t.NeedTest); err != nil {
+		if err := t.load(filepath.Join(p.Dir, file), "_test", &t.NeedTest); err != nil {
 			return err
 		}
 	}
 	for _, file := range p.XTestGoFiles {
-		if err := t.load(filepath.Join(p.SrcRoot, p.ImportPath, file), "_xtest", &t.NeedXtest); err != nil {
+		if err := t.load(filepath.Join(p.Dir, file), "_xtest", &t.NeedXtest); err != nil {
 			return err
 		}
 	}
 
-	f, err := os.Create(out)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	if err := testmainTmpl.Execute(f, t); err != nil {
+	if err := testmainTmpl.Execute(w, t); err != nil {
 		return err
 	}
 
@@ -9,12 +9,13 @@ package test
 // imported from $GOROOT/src/cmd/go/test.go
 
 import (
+	"errors"
 	"go/ast"
 	"go/build"
 	"go/doc"
 	"go/parser"
 	"go/token"
-	"os"
+	"io"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -37,45 +38,54 @@ func isTest(name, prefix string) bool {
 	return !unicode.IsLower(rune)
 }
 
-// writeTestmain writes the _testmain.go file for package p to
-// the file named out.
-func writeTestmain(out string, p *build.Package) error {
+// writeTestmain writes the _testmain.go file for package p to w,
+// using the entrypoints described by api. If cover is not empty, the
+// coverage counters it describes are registered with the testing package.
+func writeTestmain(w io.Writer, p *build.Package, api testingAPI, cover []coverVar, coverMode string) error {
 	t := &testFuncs{
-		Package: p,
+		Package:   p,
+		Testing:   api,
+		Cover:     cover,
+		CoverMode: coverMode,
+		NeedTest:  len(cover) > 0,
 	}
 	for _, file := range p.TestGoFiles {
-		if err := t.load(filepath.Join(p.SrcRoot, p.ImportPath, file), "_test", &t.NeedTest); err != nil {
+		if err := t.load(filepath.Join(p.Dir, file), "_test", &t.NeedTest); err != nil {
 			return err
 		}
 	}
 	for _, file := range p.XTestGoFiles {
-		if err := t.load(filepath.Join(p.SrcRoot, p.ImportPath, file), "_xtest", &t.NeedXtest); err != nil {
+		if err := t.load(filepath.Join(p.Dir, file), "_xtest", &t.NeedXtest); err != nil {
 			return err
 		}
 	}
-
-	f, err := os.Create(out)
-	if err != nil {
-		return err
+	if t.TestMain != nil && !api.MainStart {
+		return errors.New("TestMain is not supported by the testing package in GOROOT")
 	}
-	defer f.Close()
 
-	return testmainTmpl.Execute(f, t)
+	return testmainTmpl.Execute(w, t)
 }
 
 type testFuncs struct {
-	Tests      []testFunc
-	Benchmarks []testFunc
-	Examples   []testFunc
+	Tests       []testFunc
+	Benchmarks  []testFunc
+	FuzzTargets []testFunc
+	Examples    []testFunc
+	TestMain    *testFunc
 	*build.Package
+	Testing   testingAPI
 	NeedTest  bool
 	NeedXtest bool
+	Cover     []coverVar
+	CoverMode string
 }
 
 type testFunc struct {
 	Package string // imported package name (_test or _xtest)
 	Name    string // function name
 	Output  string // output, for examples
+	// Unordered is set if the output of an example may appear in any order.
+	Unordered bool
 }
 
 var testFileSet = token.NewFileSet()
@@ -95,11 +105,38 @@ func (t *testFuncs) load(filename, pkg string, seen *bool) error {
 		}
 		name := n.Name.String()
 		switch {
+		case name == "TestMain":
+			if isTestFunc(n, "T") {
+				// TestMain(t *testing.T) is an ordinary test.
+				t.Tests = append(t.Tests, testFunc{pkg, name, "", false})
+				*seen = true
+				continue
+			}
+			if err := checkTestFunc(testFileSet, n, "M"); err != nil {
+				return err
+			}
+			if t.TestMain != nil {
+				return errors.New("multiple definitions of TestMain")
+			}
+			t.TestMain = &testFunc{pkg, name, "", false}
+			*seen = true
 		case isTest(name, "Test"):
-			t.Tests = append(t.Tests, testFunc{pkg, name, ""})
+			if err := checkTestFunc(testFileSet, n, "T"); err != nil {
+				return err
+			}
+			t.Tests = append(t.Tests, testFunc{pkg, name, "", false})
 			*seen = true
 		case isTest(name, "Benchmark"):
-			t.Benchmarks = append(t.Benchmarks, testFunc{pkg, name, ""})
+			if err := checkTestFunc(testFileSet, n, "B"); err != nil {
+				return err
+			}
+			t.Benchmarks = append(t.Benchmarks, testFunc{pkg, name, "", false})
+			*seen = true
+		case t.Testing.Fuzz && isTest(name, "Fuzz"):
+			if err := checkTestFunc(testFileSet, n, "F"); err != nil {
+				return err
+			}
+			t.FuzzTargets = append(t.FuzzTargets, testFunc{pkg, name, "", false})
 			*seen = true
 		}
 	}
@@ -110,7 +147,12 @@ func (t *testFuncs) load(filename, pkg string, seen *bool) error {
 			// Don't run examples with no output.
 			continue
 		}
-		t.Examples = append(t.Examples, testFunc{pkg, "Example" + e.Name, e.Output})
+		if unordered(e) && !t.Testing.Unordered {
+			// Before Go 1.7 unordered output is not recognised,
+			// so the example has no output and is not run.
+			continue
+		}
+		t.Examples = append(t.Examples, testFunc{pkg, "Example" + e.Name, e.Output, unordered(e)})
 		*seen = true
 	}
 	return nil
@@ -126,8 +168,19 @@ var testmainTmpl = template.Must(template.New("main").Parse(`
 package main
 
 import (
+{{if .Testing.MainStart}}
+	"os"
+{{end}}
+{{if and .TestMain .Testing.ExitCode}}
+	"reflect"
+{{end}}
+{{if not .Testing.Deps}}
 	"regexp"
+{{end}}
 	"testing"
+{{if .Testing.Deps}}
+	"testing/internal/testdeps"
+{{end}}
 
 {{if .NeedTest}}
 	_test {{.Package.ImportPath | printf "%q"}}
@@ -149,12 +202,21 @@ var benchmarks = []testing.InternalBenchmark{
 {{end}}
 }
 
+{{if .Testing.Fuzz}}
+var fuzzTargets = []testing.InternalFuzzTarget{
+{{range .FuzzTargets}}
+	{"{{.Name}}", {{.Package}}.{{.Name}}},
+{{end}}
+}
+{{end}}
+
 var examples = []testing.InternalExample{
 {{range .Examples}}
-	{"{{.Name}}", {{.Package}}.{{.Name}}, {{.Output | printf "%q"}}},
+	{Name: "{{.Name}}", F: {{.Package}}.{{.Name}}, Output: {{.Output | printf "%q"}}{{if .Unordered}}, Unordered: true{{end}}},
 {{end}}
 }
 
+{{if not .Testing.Deps}}
 var matchPat string
 var matchRe *regexp.Regexp
 
@@ -168,9 +230,67 @@ func matchString(pat, str string) (result bool, err error) {
 	}
 	return matchRe.MatchString(str), nil
 }
+{{end}}
+
+{{if .Cover}}
+// Only updated by init functions, so no need for atomicity.
+var (
+	coverCounters = make(map[string][]uint32)
+	coverBlocks   = make(map[string][]testing.CoverBlock)
+)
+
+func init() {
+	{{range .Cover}}
+	coverRegisterFile({{.Profile | printf "%q"}}, _test.{{.Var}}.Count[:], _test.{{.Var}}.Pos[:], _test.{{.Var}}.NumStmt[:])
+	{{end}}
+}
+
+func coverRegisterFile(fileName string, counter []uint32, pos []uint32, numStmts []uint16) {
+	if 3*len(counter) != len(pos) || len(counter) != len(numStmts) {
+		panic("coverage: mismatched sizes")
+	}
+	if coverCounters[fileName] != nil {
+		// Already registered.
+		return
+	}
+	coverCounters[fileName] = counter
+	block := make([]testing.CoverBlock, len(counter))
+	for i := range counter {
+		block[i] = testing.CoverBlock{
+			Line0: pos[3*i+0],
+			Col0:  uint16(pos[3*i+2]),
+			Line1: pos[3*i+1],
+			Col1:  uint16(pos[3*i+2] >> 16),
+			Stmts: numStmts[i],
+		}
+	}
+	coverBlocks[fileName] = block
+}
+{{end}}
 
 func main() {
+{{if .Cover}}
+	testing.RegisterCover(testing.Cover{
+		Mode:     {{printf "%q" .CoverMode}},
+		Counters: coverCounters,
+		Blocks:   coverBlocks,
+	})
+{{end}}
+{{if .Testing.MainStart}}
+	m := testing.MainStart({{if .Testing.Deps}}testdeps.TestDeps{}{{else}}matchString{{end}}, tests, benchmarks, {{if .Testing.Fuzz}}fuzzTargets, {{end}}examples)
+{{with .TestMain}}
+	{{.Package}}.{{.Name}}(m)
+{{if $.Testing.ExitCode}}
+	os.Exit(int(reflect.ValueOf(m).Elem().FieldByName("exitCode").Int()))
+{{else}}
+	os.Exit(0)
+{{end}}
+{{else}}
+	os.Exit(m.Run())
+{{end}}
+{{else}}
 	testing.Main(matchString, tests, benchmarks, examples)
+{{end}}
 }
 
 `))
@@ -0,0 +1,87 @@
+package test
+
+// conversion of test output to events
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single event in the life of a test, as reported by
+// gogo test -json.
+type Event struct {
+	Time    time.Time `json:",omitempty"`
+	Action  string
+	Package string  `json:",omitempty"`
+	Test    string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"` // seconds
+	Output  string  `json:",omitempty"`
+}
+
+var (
+	// === RUN   TestFoo
+	startRe = regexp.MustCompile(`^=== (RUN|PAUSE|CONT)\s+(\S+)`)
+
+	// --- PASS: TestFoo (0.01s)
+	endRe = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s?(?: seconds)?\)`)
+)
+
+// Events converts the output of a test binary for the package
+// importpath, run with -test.v, into Events. elapsed is the time taken
+// to run the binary, and failed reports whether the binary failed.
+func Events(importpath string, output []byte, elapsed time.Duration, failed bool) []Event {
+	now := time.Now()
+	var events []Event
+	emit := func(action, test string, elapsed float64, output string) {
+		events = append(events, Event{
+			Time:    now,
+			Action:  action,
+			Package: importpath,
+			Test:    test,
+			Elapsed: elapsed,
+			Output:  output,
+		})
+	}
+	var current string // the test which is producing output
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		line := s.Text()
+		if m := startRe.FindStringSubmatch(line); m != nil {
+			current = m[2]
+			emit(strings.ToLower(m[1]), current, 0, "")
+			emit("output", current, 0, line+"\n")
+			continue
+		}
+		if m := endRe.FindStringSubmatch(line); m != nil {
+			secs, _ := strconv.ParseFloat(m[3], 64)
+			emit("output", m[2], 0, line+"\n")
+			emit(strings.ToLower(m[1]), m[2], secs, "")
+			current = parentTest(m[2])
+			continue
+		}
+		switch strings.TrimSpace(line) {
+		case "PASS", "FAIL":
+			current = ""
+		}
+		emit("output", current, 0, line+"\n")
+	}
+	action := "pass"
+	if failed {
+		action = "fail"
+	}
+	emit(action, "", elapsed.Seconds(), "")
+	return events
+}
+
+// parentTest returns the name of the test which contains the subtest
+// name, or the empty string if name is not a subtest.
+func parentTest(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const verboseOutput = `=== RUN TestA
+--- PASS: TestA (0.01 seconds)
+=== RUN TestB
+=== RUN   TestB/sub
+    b_test.go:10: oops
+    --- FAIL: TestB/sub (0.00s)
+--- FAIL: TestB (0.02s)
+=== RUN TestC
+--- SKIP: TestC (0.00s)
+FAIL
+`
+
+type action struct {
+	Action, Test string
+	Elapsed      float64
+}
+
+func TestEvents(t *testing.T) {
+	events := Events("a", []byte(verboseOutput), 100*time.Millisecond, true)
+	var got []action
+	for _, e := range events {
+		if e.Package != "a" {
+			t.Fatalf("event %v: expected package %q", e, "a")
+		}
+		if e.Action == "output" {
+			if e.Output == "    b_test.go:10: oops\n" && e.Test != "TestB/sub" {
+				t.Errorf("output %q: expected test %q, got %q", e.Output, "TestB/sub", e.Test)
+			}
+			continue
+		}
+		got = append(got, action{e.Action, e.Test, e.Elapsed})
+	}
+	want := []action{
+		{"run", "TestA", 0},
+		{"pass", "TestA", 0.01},
+		{"run", "TestB", 0},
+		{"run", "TestB/sub", 0},
+		{"fail", "TestB/sub", 0},
+		{"fail", "TestB", 0.02},
+		{"run", "TestC", 0},
+		{"skip", "TestC", 0},
+		{"fail", "", 0.1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Events: expected %v, got %v", want, got)
+	}
+}
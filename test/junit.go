@@ -0,0 +1,103 @@
+package test
+
+// JUnit XML reports
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestsuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+type junitTestcase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report of events, which may cover
+// many packages, to w. Each package is reported as a testsuite.
+func WriteJUnit(w io.Writer, events []Event) error {
+	var suites junitTestsuites
+	index := make(map[string]int) // package to suite
+	output := make(map[string][]string)
+	for _, e := range events {
+		i, ok := index[e.Package]
+		if !ok {
+			i = len(suites.Suites)
+			index[e.Package] = i
+			suites.Suites = append(suites.Suites, junitTestsuite{Name: e.Package})
+		}
+		suite := &suites.Suites[i]
+		key := e.Package + " " + e.Test
+		switch e.Action {
+		case "output":
+			output[key] = append(output[key], e.Output)
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				suite.Time = seconds(e.Elapsed)
+				if e.Action == "fail" && suite.Tests == 0 {
+					// the binary failed without running any tests,
+					// report the package itself as a failure.
+					suite.Tests++
+					suite.Failures++
+					suite.Cases = append(suite.Cases, junitTestcase{
+						Classname: e.Package,
+						Name:      "[package]",
+						Time:      suite.Time,
+						Failure:   &junitMessage{"Failed", strings.Join(output[key], "")},
+					})
+				}
+				continue
+			}
+			tc := junitTestcase{
+				Classname: e.Package,
+				Name:      e.Test,
+				Time:      seconds(e.Elapsed),
+			}
+			suite.Tests++
+			switch e.Action {
+			case "fail":
+				suite.Failures++
+				tc.Failure = &junitMessage{"Failed", strings.Join(output[key], "")}
+			case "skip":
+				suite.Skipped++
+				tc.Skipped = &junitMessage{"Skipped", strings.Join(output[key], "")}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(s float64) string { return fmt.Sprintf("%.3f", s) }
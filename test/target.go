@@ -2,16 +2,13 @@ package test
 
 import (
 	gobuild "go/build"
-	"path/filepath"
-
-	"github.com/davecheney/gogo/build"
 )
 
 // target implements a build.Future
 type target struct {
 	err chan error
 	*gobuild.Package
-	*build.Context
+	*Context
 }
 
 func (t *target) Result() error {
@@ -20,7 +17,7 @@ func (t *target) Result() error {
 	return result
 }
 
-func newTarget(ctx *build.Context, pkg *gobuild.Package) target {
+func newTarget(ctx *Context, pkg *gobuild.Package) target {
 	return target{
 		err:     make(chan error, 1),
 		Context: ctx,
@@ -29,5 +26,5 @@ func newTarget(ctx *build.Context, pkg *gobuild.Package) target {
 }
 
 func (t *target) Srcdir() string {
-	return filepath.Join(t.SrcRoot, t.ImportPath)
+	return t.Dir
 }
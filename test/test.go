@@ -2,36 +2,182 @@
 package test
 
 import (
+	"bytes"
+	"fmt"
 	gobuild "go/build"
-	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/davecheney/gogo/build"
+	"github.com/davecheney/gogo/cover"
 	"github.com/davecheney/gogo/log"
 )
 
+// Future represents the result of testing a package.
+type Future interface {
+	build.Future
+
+	// Output returns the combined stdout and stderr of the test
+	// binary. Output blocks until the Result is available.
+	Output() []byte
+
+	// Elapsed returns the time taken to run the test binary.
+	// Elapsed blocks until the Result is available.
+	Elapsed() time.Duration
+
+	// Cached reports whether the Output was replayed from the test
+	// cache rather than by running the test binary.
+	// Cached blocks until the Result is available.
+	Cached() bool
+}
+
+// Failure is returned by a Future when the test binary for a
+// package ran, but reported a failure.
+type Failure struct {
+	ImportPath string
+	Err        error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("test %q failed: %v", f.ImportPath, f.Err)
+}
+
 type errFuture struct{ error }
 
-func (e errFuture) Result() error { return e.error }
+func (e errFuture) Result() error          { return e.error }
+func (e errFuture) Output() []byte         { return nil }
+func (e errFuture) Elapsed() time.Duration { return 0 }
+func (e errFuture) Cached() bool           { return false }
+
+// Context represents the settings used to test packages.
+type Context struct {
+	*build.Context
+
+	// Cover enables coverage analysis of the packages under test.
+	Cover bool
+
+	// CoverMode is the coverage mode, one of cover.Set, cover.Count
+	// or cover.Atomic.
+	CoverMode string
+
+	// Count is the number of times to run each test. If Count
+	// is set, test results are not cached.
+	Count int
+
+	// Bench is a regular expression selecting the benchmarks to run.
+	// If Bench is set, tests are not run and results are not cached.
+	Bench string
+
+	// Cache is the directory where the results of successful test
+	// runs are stored. If Cache is empty, results are not cached.
+	Cache string
+
+	// Verbose causes test binaries to report the progress of each test.
+	Verbose bool
+
+	// Parallel is the maximum number of test binaries which
+	// may run at once.
+	Parallel int
+
+	once   sync.Once
+	tokens chan struct{}
+
+	apiOnce sync.Once
+	api     testingAPI
+	apiErr  error
+}
+
+// NewContext returns a Context which tests packages using ctx.
+func NewContext(ctx *build.Context) *Context {
+	return &Context{
+		Context:   ctx,
+		CoverMode: cover.Set,
+		Parallel:  runtime.NumCPU(),
+	}
+}
+
+// acquire blocks until a test binary may be run, or the
+// Context is cancelled.
+func (c *Context) acquire() error {
+	c.once.Do(func() {
+		n := c.Parallel
+		if n < 1 {
+			n = 1
+		}
+		c.tokens = make(chan struct{}, n)
+	})
+	select {
+	case c.tokens <- struct{}{}:
+		return nil
+	case <-c.Done():
+		return build.ErrCancelled
+	}
+}
+
+// release returns the token taken by acquire.
+func (c *Context) release() { <-c.tokens }
+
+// buildToken is a build.Future which completes once a token has been
+// taken with acquire, so the number of test binaries being built, like
+// the number being run, is bounded by Parallel.
+type buildToken struct {
+	ctx *Context
+	err chan error
+}
+
+func newBuildToken(ctx *Context) *buildToken {
+	t := &buildToken{ctx: ctx, err: make(chan error, 1)}
+	go func() { t.err <- ctx.acquire() }()
+	return t
+}
+
+func (t *buildToken) Result() error {
+	err := <-t.err
+	t.err <- err
+	return err
+}
+
+// release returns the token, once it has been taken.
+func (t *buildToken) release() {
+	if t.Result() == nil {
+		t.ctx.release()
+	}
+}
 
 // Test returns a Future representing the result of compiling the
 // package pkg, and its dependencies, and linking it with the
 // test runner.
-func Test(ctx *build.Context, pkg *gobuild.Package) build.Future {
+func Test(ctx *Context, pkg *gobuild.Package) Future {
 	// commands are built as packages for testing.
 	return testPackage(ctx, pkg)
 }
 
-func testPackage(ctx *build.Context, pkg *gobuild.Package) build.Future {
-	var gofiles []string
-	gofiles = append(gofiles, pkg.GoFiles...)
-	gofiles = append(gofiles, pkg.TestGoFiles...)
+// Binary returns a Future representing the result of building the
+// test binary for pkg and copying it to dst. The test binary is not run.
+func Binary(ctx *Context, pkg *gobuild.Package, dst string) build.Future {
+	testpkg, buildtest, err := buildTestPackage(ctx, pkg)
+	if err != nil {
+		return &errFuture{err}
+	}
+	return copyTest(ctx, testpkg, dst, buildtest)
+}
 
-	var cgofiles []string
-	cgofiles = append(cgofiles, pkg.CgoFiles...)
+func testPackage(ctx *Context, pkg *gobuild.Package) Future {
+	testpkg, buildtest, err := buildTestPackage(ctx, pkg)
+	if err != nil {
+		return &errFuture{err}
+	}
+	return runTest(ctx, testpkg, buildtest)
+}
 
+// buildTestPackage returns the package under test, and a Future
+// representing the result of linking its test binary.
+func buildTestPackage(ctx *Context, pkg *gobuild.Package) (*gobuild.Package, build.Future, error) {
 	var imports []string
 	imports = append(imports, pkg.Imports...)
 	imports = append(imports, pkg.TestImports...)
@@ -39,41 +185,62 @@ func testPackage(ctx *build.Context, pkg *gobuild.Package) build.Future {
 	// build dependencies
 	var deps []build.Future
 	for _, dep := range imports {
-		pkg, err := ctx.ResolvePackage("linux", "amd64", dep).Result()
+		pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), dep).Result()
 		if err != nil {
-			return &errFuture{err}
+			return nil, nil, err
+		}
+		deps = append(deps, build.Build(ctx.Context, pkg))
+	}
+
+	var gofiles []string
+	var vars []coverVar
+	if ctx.Cover {
+		vars = coverVars(pkg)
+		deps = append(deps, coverPackage(ctx, pkg, vars))
+		for _, v := range vars {
+			gofiles = append(gofiles, filepath.Join(testobjdir(ctx, pkg), v.File))
 		}
-		deps = append(deps, build.Build(ctx, pkg))
+	} else {
+		gofiles = append(gofiles, pkg.GoFiles...)
 	}
+	gofiles = append(gofiles, pkg.TestGoFiles...)
+
+	var cgofiles []string
+	cgofiles = append(cgofiles, pkg.CgoFiles...)
 
 	testpkg := &gobuild.Package{
 		Name:       pkg.Name,
 		ImportPath: pkg.ImportPath,
-		// Srcdir:     pkg.Srcdir,
+		SrcRoot:    pkg.SrcRoot,
+		Dir:        pkg.Dir,
 
 		GoFiles:     gofiles,
 		CgoFiles:    cgofiles,
 		TestGoFiles: pkg.TestGoFiles, // passed directly to buildTestMain
 
+		EmbedPatterns: append(append([]string{}, pkg.EmbedPatterns...), pkg.TestEmbedPatterns...),
+
 		Imports: imports,
 	}
-	compile := build.Compile(ctx, testpkg, deps)
-	buildtest := buildTest(ctx, testpkg, compile)
-	runtest := runTest(ctx, testpkg, buildtest)
-	return runtest
+	// the package under test is compiled and linked holding a token,
+	// which is returned before the test binary is run.
+	token := newBuildToken(ctx)
+	compile := build.Compile(ctx.Context, testpkg, append(deps, token))
+	return testpkg, buildTest(ctx, testpkg, vars, token, compile), nil
 }
 
 type buildTestTarget struct {
 	target
-	deps []build.Future
+	deps  []build.Future
+	cover []coverVar
+	token *buildToken
 }
 
 func (t *buildTestTarget) execute() {
-	for _, dep := range t.deps {
-		if err := dep.Result(); err != nil {
-			t.err <- err
-			return
-		}
+	defer t.token.release()
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
 	}
 	t.err <- t.build()
 }
@@ -83,20 +250,31 @@ func (t *buildTestTarget) build() error {
 	if err := t.buildTestMain(objdir); err != nil {
 		return err
 	}
-	if err := t.Gc(objdir, objdir, t.Package.Name+".6", []string{"_testmain.go"}); err != nil {
-		return err
+	if err := t.Gc("main", objdir, t.Package.Name+".6", "", nil, []string{"_testmain.go"}); err != nil {
+		return t.Report(t.Package, "gc", err)
 	}
-	return t.Ld(filepath.Join(objdir, t.Package.Name+".test"), filepath.Join(objdir, t.Package.Name+".6"))
+	err := t.Ld(testBinary(t.Context, t.Package), filepath.Join(objdir, t.Package.Name+".6"))
+	return t.Report(t.Package, "ld", err)
 }
 
-func (t *buildTestTarget) buildTestMain(_ string) error {
-	return writeTestmain(filepath.Join(objdir(t.Context, t.Package), "_testmain.go"), t.Package)
+func (t *buildTestTarget) buildTestMain(objdir string) error {
+	api, err := t.testingAPI()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := writeTestmain(&buf, t.Package, api, t.cover, t.CoverMode); err != nil {
+		return err
+	}
+	return t.WriteFile(filepath.Join(objdir, "_testmain.go"), buf.Bytes())
 }
 
-func buildTest(ctx *build.Context, pkg *gobuild.Package, deps ...build.Future) build.Future {
+func buildTest(ctx *Context, pkg *gobuild.Package, cover []coverVar, token *buildToken, deps ...build.Future) build.Future {
 	t := &buildTestTarget{
 		target: newTarget(ctx, pkg),
 		deps:   deps,
+		cover:  cover,
+		token:  token,
 	}
 	go t.execute()
 	return t
@@ -104,30 +282,90 @@ func buildTest(ctx *build.Context, pkg *gobuild.Package, deps ...build.Future) b
 
 type runTestTarget struct {
 	target
-	deps []build.Future
+	deps    []build.Future
+	output  bytes.Buffer
+	elapsed time.Duration
+	cached  bool
 }
 
 func (t *runTestTarget) execute() {
-	for _, dep := range t.deps {
-		if err := dep.Result(); err != nil {
-			t.err <- err
-			return
-		}
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
 	}
-	log.Infof("test %q", t.Package.ImportPath)
 	t.err <- t.build()
 }
 
 func (t *runTestTarget) build() error {
-	cmd := exec.Command(filepath.Join(objdir(t.Context, t.Package), t.Package.Name+".test"))
+	if err := t.acquire(); err != nil {
+		return err
+	}
+	defer t.release()
+	log.Infof("test %q", t.Package.ImportPath)
+	var args []string
+	if t.Verbose {
+		args = append(args, "-test.v")
+	}
+	if t.Bench != "" {
+		args = append(args, "-test.run=^$", "-test.bench="+t.Bench, "-test.benchmem")
+	}
+	if t.Count > 0 {
+		args = append(args, "-test.count="+strconv.Itoa(t.Count))
+	}
+	if t.Cover {
+		args = append(args, "-test.coverprofile="+CoverProfile(t.Context, t.Package))
+	}
+	binary := testBinary(t.Context, t.Package)
+	var key string
+	if t.cacheable() {
+		var err error
+		key, err = t.cacheKey(args)
+		if err != nil {
+			return err
+		}
+		if output, ok := t.readCache(key); ok {
+			log.Debugf("test %q: cached result %s", t.ImportPath, key)
+			t.output.Write(output)
+			t.cached = true
+			return nil
+		}
+	}
+	cmd := exec.Command(binary, args...)
 	cmd.Dir = t.Srcdir()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	log.Infof("cd %s; %s", cmd.Dir, strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	cmd.Stdout = &t.output
+	cmd.Stderr = &t.output
+	log.Debugf("cd %s; %s", cmd.Dir, strings.Join(cmd.Args, " "))
+	t0 := time.Now()
+	err := t.Run(cmd)
+	t.elapsed = time.Since(t0)
+	t.Record("test", t.elapsed)
+	if _, ok := err.(*exec.ExitError); ok {
+		return &Failure{ImportPath: t.ImportPath, Err: err}
+	}
+	if err == nil && key != "" {
+		if err := t.writeCache(key, t.output.Bytes()); err != nil {
+			log.Warnf("could not cache result of test %q: %v", t.ImportPath, err)
+		}
+	}
+	return err
+}
+
+func (t *runTestTarget) Output() []byte {
+	t.Result()
+	return t.output.Bytes()
+}
+
+func (t *runTestTarget) Elapsed() time.Duration {
+	t.Result()
+	return t.elapsed
 }
 
-func runTest(ctx *build.Context, pkg *gobuild.Package, deps ...build.Future) build.Future {
+func (t *runTestTarget) Cached() bool {
+	t.Result()
+	return t.cached
+}
+
+func runTest(ctx *Context, pkg *gobuild.Package, deps ...build.Future) Future {
 	t := &runTestTarget{
 		target: newTarget(ctx, pkg),
 		deps:   deps,
@@ -136,12 +374,41 @@ func runTest(ctx *build.Context, pkg *gobuild.Package, deps ...build.Future) bui
 	return t
 }
 
+type copyTestTarget struct {
+	target
+	dst  string
+	deps []build.Future
+}
+
+func (t *copyTestTarget) execute() {
+	if err := t.WaitDeps(t.deps...); err != nil {
+		t.err <- err
+		return
+	}
+	t.err <- t.Copy(t.dst, testBinary(t.Context, t.Package))
+}
+
+func copyTest(ctx *Context, pkg *gobuild.Package, dst string, deps ...build.Future) build.Future {
+	t := &copyTestTarget{
+		target: newTarget(ctx, pkg),
+		dst:    dst,
+		deps:   deps,
+	}
+	go t.execute()
+	return t
+}
+
+// testBinary returns the path of the linked test binary for this Package.
+func testBinary(ctx *Context, pkg *gobuild.Package) string {
+	return filepath.Join(objdir(ctx, pkg), pkg.Name+".test")
+}
+
 // testobjdir returns the destination for test object files compiled for this Package.
-func testobjdir(ctx *build.Context, pkg *gobuild.Package) string {
+func testobjdir(ctx *Context, pkg *gobuild.Package) string {
 	return filepath.Join(ctx.Workdir(), filepath.FromSlash(pkg.ImportPath), "_test")
 }
 
 // objdir returns the destination for object files compiled for this Package.
-func objdir(ctx *build.Context, pkg *gobuild.Package) string {
+func objdir(ctx *Context, pkg *gobuild.Package) string {
 	return filepath.Join(ctx.Workdir(), filepath.FromSlash(pkg.ImportPath), "_obj")
 }
@@ -1,13 +1,35 @@
 package test
 
 import (
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/davecheney/gogo/build"
 	"github.com/davecheney/gogo/project"
 )
 
+const root = "../testdata"
+
+func newProject(t *testing.T) *project.Project {
+	p, err := project.NewProject(root)
+	if err != nil {
+		t.Fatalf("could not resolve project root %q: %v", root, err)
+	}
+	return p
+}
+
+func newTestContext(t *testing.T) *Context {
+	ctx, err := build.NewDefaultContext(newProject(t))
+	if err != nil {
+		t.Fatalf("NewDefaultContext(): %v", err)
+	}
+	return NewContext(ctx)
+}
+
 var testPackageTests = []struct {
 	pkg string
 }{
@@ -29,7 +51,7 @@ func TestTestPackage(t *testing.T) {
 		if err != nil {
 			t.Fatalf("ResolvePackage(): %v", err)
 		}
-		if err := testPackage(ctx, pkg).Result(); err != nil {
+		if err := testPackage(NewContext(ctx), pkg).Result(); err != nil {
 			t.Fatalf("testPackage %q: %v", tt.pkg, err)
 		}
 	}
@@ -38,25 +60,90 @@ func TestTestPackage(t *testing.T) {
 func TestTest(t *testing.T) {
 	project := newProject(t)
 	for _, tt := range testPackageTests {
-		ctx, err := gogo.NewDefaultContext(project)
+		ctx, err := build.NewDefaultContext(project)
 		if err != nil {
 			t.Fatalf("NewDefaultContext(): %v", err)
 		}
 		defer ctx.Destroy()
-		pkg, err := ctx.ResolvePackage(tt.pkg)
+		pkg, err := ctx.ResolvePackage("linux", "amd64", tt.pkg).Result()
 		if err != nil {
 			t.Fatalf("ResolvePackage(): %v", err)
 		}
-		if err := Test(ctx, pkg).Result(); err != nil {
+		if err := Test(NewContext(ctx), pkg).Result(); err != nil {
 			t.Fatalf("testPackage %q: %v", tt.pkg, err)
 		}
 	}
 }
 
+// TestBuildTestCoverCgo builds the test binary of a cgo package with
+// coverage enabled, and the package cache, which keys the coverage
+// copies of the package's files in the work directory.
+func TestBuildTestCoverCgo(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	tmp, err := ioutil.TempDir("", "gogo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := newTestContext(t)
+	defer ctx.Destroy()
+	ctx.Cover = true
+	ctx.Context.Cache = tmp
+	pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "covercgo").Result()
+	if err != nil {
+		t.Fatalf("ResolvePackage(): %v", err)
+	}
+	testpkg, f, err := buildTestPackage(ctx, pkg)
+	if err != nil {
+		t.Fatalf("buildTestPackage(): %v", err)
+	}
+	if err := f.Result(); err != nil {
+		t.Fatalf("buildTestPackage(): %v", err)
+	}
+	if _, err := os.Stat(testBinary(ctx, testpkg)); err != nil {
+		t.Errorf("buildTestPackage(): %v", err)
+	}
+}
+
+// TestBuildTestParallel checks that a test binary is not built while
+// every one of the Parallel tokens is taken.
+func TestBuildTestParallel(t *testing.T) {
+	ctx := newTestContext(t)
+	defer ctx.Destroy()
+	ctx.Parallel = 1
+	if err := ctx.acquire(); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "a").Result()
+	if err != nil {
+		t.Fatalf("ResolvePackage(): %v", err)
+	}
+	testpkg, f, err := buildTestPackage(ctx, pkg)
+	if err != nil {
+		t.Fatalf("buildTestPackage(): %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- f.Result() }()
+	select {
+	case err := <-done:
+		t.Fatalf("buildTestPackage(): built while the only token was taken: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if _, err := os.Stat(objdir(ctx, testpkg)); !os.IsNotExist(err) {
+		t.Fatalf("buildTestPackage(): compiled while the only token was taken: %v", err)
+	}
+	ctx.release()
+	if err := <-done; err != nil {
+		t.Fatalf("buildTestPackage(): %v", err)
+	}
+}
+
 func TestTestObjdir(t *testing.T) {
 	ctx := newTestContext(t)
 	defer ctx.Destroy()
-	pkg, err := ctx.ResolvePackage("a")
+	pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "a").Result()
 	if err != nil {
 		t.Fatalf("project.ResolvePackage(): %v", err)
 	}
@@ -64,3 +151,32 @@ func TestTestObjdir(t *testing.T) {
 		t.Fatalf("pkg.Objdir(): expected %q, got %q", filepath.Join(ctx.Workdir(), pkg.ImportPath, "_test"), testdir)
 	}
 }
+
+func TestCopyTest(t *testing.T) {
+	ctx := newTestContext(t)
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage(ctx.GOOS(), ctx.GOARCH(), "a").Result()
+	if err != nil {
+		t.Fatalf("project.ResolvePackage(): %v", err)
+	}
+	if err := os.MkdirAll(objdir(ctx, pkg), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(testBinary(ctx, pkg), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(ctx.Workdir(), "a.test")
+	if err := copyTest(ctx, pkg, dst).Result(); err != nil {
+		t.Fatalf("copyTest: %v", err)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "binary" {
+		t.Errorf("copyTest: expected %q, got %q", "binary", data)
+	}
+	if fi, err := os.Stat(dst); err != nil || fi.Mode()&0100 == 0 {
+		t.Errorf("copyTest: expected %s to be executable: %v", dst, err)
+	}
+}
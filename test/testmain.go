@@ -0,0 +1,156 @@
+package test
+
+// support for the testmain generators
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// testingAPI describes the entrypoints offered by the testing package
+// of a particular GOROOT.
+type testingAPI struct {
+	// MainStart is set if testing.MainStart is available, which is
+	// required to support TestMain.
+	MainStart bool
+
+	// Deps is set if MainStart takes a testDeps value, rather than
+	// a matchString function, as its first argument.
+	Deps bool
+
+	// Fuzz is set if MainStart accepts a list of fuzz targets.
+	Fuzz bool
+
+	// ExitCode is set if testing.M records the result of m.Run,
+	// which allows TestMain to return without calling os.Exit.
+	ExitCode bool
+
+	// Unordered is set if examples may declare that their output
+	// appears in any order, which requires Go 1.7 or later.
+	Unordered bool
+}
+
+// loadTestingAPI inspects the source of the testing package in goroot.
+func loadTestingAPI(goroot string) (testingAPI, error) {
+	var api testingAPI
+	dir := filepath.Join(goroot, "src", "testing")
+	if _, err := os.Stat(dir); err != nil {
+		// before Go 1.4 the standard library lived in src/pkg.
+		dir = filepath.Join(goroot, "src", "pkg", "testing")
+	}
+	for _, name := range []string{"testing.go", "example.go"} {
+		filename := filepath.Join(dir, name)
+		if _, err := os.Stat(filename); err != nil && name == "example.go" {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+		if err != nil {
+			return api, fmt.Errorf("could not inspect testing package: %v", err)
+		}
+		inspectTesting(f, &api)
+	}
+	return api, nil
+}
+
+// inspectTesting records the entrypoints declared in f, a file of the
+// testing package, in api.
+func inspectTesting(f *ast.File, api *testingAPI) {
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil || d.Name.Name != "MainStart" {
+				continue
+			}
+			api.MainStart = true
+			params := d.Type.Params.List
+			if len(params) > 0 {
+				_, fn := params[0].Type.(*ast.FuncType)
+				api.Deps = !fn
+			}
+			api.Fuzz = countFields(params) == 5
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					for _, name := range field.Names {
+						switch {
+						case ts.Name.Name == "M" && name.Name == "exitCode":
+							api.ExitCode = true
+						case ts.Name.Name == "InternalExample" && name.Name == "Unordered":
+							api.Unordered = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// countFields returns the number of parameters declared by fields.
+func countFields(fields []*ast.Field) int {
+	var n int
+	for _, f := range fields {
+		if len(f.Names) == 0 {
+			n++
+		}
+		n += len(f.Names)
+	}
+	return n
+}
+
+// testingAPI returns the testingAPI of the testing package used to
+// build test binaries in this Context.
+func (c *Context) testingAPI() (testingAPI, error) {
+	c.apiOnce.Do(func() {
+		c.api, c.apiErr = loadTestingAPI(c.GOROOT())
+	})
+	return c.api, c.apiErr
+}
+
+// isTestFunc reports whether fn takes a single argument of type
+// *testing.<arg>, and returns nothing.
+func isTestFunc(fn *ast.FuncDecl, arg string) bool {
+	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 ||
+		fn.Type.Params.List == nil ||
+		len(fn.Type.Params.List) != 1 ||
+		len(fn.Type.Params.List[0].Names) > 1 {
+		return false
+	}
+	ptr, ok := fn.Type.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	// We can't easily check that the type is *testing.M
+	// because we don't know how testing has been imported,
+	// but at least check that it's *M or *something.M.
+	if name, ok := ptr.X.(*ast.Ident); ok && name.Name == arg {
+		return true
+	}
+	if sel, ok := ptr.X.(*ast.SelectorExpr); ok && sel.Sel.Name == arg {
+		return true
+	}
+	return false
+}
+
+// checkTestFunc returns an error if fn is not a valid test function
+// taking a *testing.<arg>.
+func checkTestFunc(fset *token.FileSet, fn *ast.FuncDecl, arg string) error {
+	if isTestFunc(fn, arg) {
+		return nil
+	}
+	name := fn.Name.String()
+	pos := fset.Position(fn.Pos())
+	return fmt.Errorf("%s: wrong signature for %s, must be: func %s(%s *testing.%s)", pos, name, name, strings.ToLower(arg), arg)
+}
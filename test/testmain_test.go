@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var isTestFuncTests = []struct {
+	src  string
+	arg  string
+	want bool
+}{
+	{"func TestA(t *testing.T) {}", "T", true},
+	{"func TestA(t *T) {}", "T", true},
+	{"func TestA(t *testing.B) {}", "T", false},
+	{"func TestA(t testing.T) {}", "T", false},
+	{"func TestA() {}", "T", false},
+	{"func TestA(t *testing.T) error { return nil }", "T", false},
+	{"func TestA(t, u *testing.T) {}", "T", false},
+	{"func TestMain(m *testing.M) {}", "M", true},
+	{"func FuzzA(f *testing.F) {}", "F", true},
+}
+
+func TestIsTestFunc(t *testing.T) {
+	for _, tt := range isTestFuncTests {
+		f, err := parser.ParseFile(token.NewFileSet(), "x_test.go", "package x\n"+tt.src, 0)
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", tt.src, err)
+		}
+		fn := f.Decls[0].(*ast.FuncDecl)
+		if got := isTestFunc(fn, tt.arg); got != tt.want {
+			t.Errorf("isTestFunc(%q, %q): expected %v, got %v", tt.src, tt.arg, tt.want, got)
+		}
+	}
+}
+
+var loadTestingAPITests = []struct {
+	src     string
+	example string // the contents of example.go, if any
+	want    testingAPI
+}{
+	{
+		"func Main(matchString func(pat, str string) (bool, error), tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) {}",
+		"",
+		testingAPI{},
+	},
+	{
+		"type M struct{ tests []InternalTest }\n" +
+			"func MainStart(matchString func(pat, str string) (bool, error), tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) *M { return nil }",
+		"",
+		testingAPI{MainStart: true},
+	},
+	{
+		"type M struct{ deps testDeps }\n" +
+			"func MainStart(deps testDeps, tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) *M { return nil }",
+		"type InternalExample struct{ Name string; F func(); Output string }",
+		testingAPI{MainStart: true, Deps: true},
+	},
+	{
+		"type M struct{ deps testDeps; exitCode int }\n" +
+			"func MainStart(deps testDeps, tests []InternalTest, benchmarks []InternalBenchmark, fuzzTargets []InternalFuzzTarget, examples []InternalExample) *M { return nil }",
+		"type InternalExample struct{ Name string; F func(); Output string; Unordered bool }",
+		testingAPI{MainStart: true, Deps: true, Fuzz: true, ExitCode: true, Unordered: true},
+	},
+}
+
+func TestLoadTestingAPI(t *testing.T) {
+	goroot, err := ioutil.TempDir("", "goroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(goroot)
+	dir := filepath.Join(goroot, "src", "testing")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range loadTestingAPITests {
+		if err := ioutil.WriteFile(filepath.Join(dir, "testing.go"), []byte("package testing\n"+tt.src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(filepath.Join(dir, "example.go"))
+		if tt.example != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, "example.go"), []byte("package testing\n"+tt.example), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := loadTestingAPI(goroot)
+		if err != nil {
+			t.Fatalf("loadTestingAPI(%q): %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("loadTestingAPI(%q): expected %+v, got %+v", tt.src, tt.want, got)
+		}
+	}
+}
+
+// TestWriteTestmainUnordered checks that examples with unordered output
+// are only run if the testing package in GOROOT supports them.
+func TestWriteTestmainUnordered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "package a\n\nimport \"fmt\"\n\nfunc ExampleA() {\n\tfmt.Println(1)\n\tfmt.Println(2)\n\t// Unordered output:\n\t// 2\n\t// 1\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "a_test.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	pkg := &build.Package{Name: "a", ImportPath: "a", Dir: dir, TestGoFiles: []string{"a_test.go"}}
+	for _, tt := range []struct {
+		api  testingAPI
+		want string
+	}{
+		{testingAPI{Unordered: true}, `{Name: "ExampleA", F: _test.ExampleA, Output: "2\n1\n", Unordered: true}`},
+		{testingAPI{}, ""},
+	} {
+		var buf bytes.Buffer
+		if err := writeTestmain(&buf, pkg, tt.api, nil, ""); err != nil {
+			t.Fatalf("writeTestmain(%+v): %v", tt.api, err)
+		}
+		got := buf.String()
+		if tt.want == "" {
+			if strings.Contains(got, "ExampleA") {
+				t.Errorf("writeTestmain(%+v): expected ExampleA not to be run\n%s", tt.api, got)
+			}
+			continue
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("writeTestmain(%+v): expected %s\n%s", tt.api, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	gobuild "go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTestBinaryPaths(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gogo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd := filepath.Join(tmp, "wd")
+	out := filepath.Join(tmp, "out")
+	a := &gobuild.Package{ImportPath: "a"}
+	b := &gobuild.Package{ImportPath: "x/b"}
+	tests := []struct {
+		pkgs []*gobuild.Package
+		o    string
+		goos string
+		want []string
+		err  bool
+	}{
+		// -c writes to the current directory.
+		{pkgs: []*gobuild.Package{a}, goos: "linux", want: []string{filepath.Join(wd, "a.test")}},
+		{pkgs: []*gobuild.Package{a, b}, goos: "linux", want: []string{filepath.Join(wd, "a.test"), filepath.Join(wd, "b.test")}},
+		{pkgs: []*gobuild.Package{a}, goos: "windows", want: []string{filepath.Join(wd, "a.test.exe")}},
+
+		// -o names a directory.
+		{pkgs: []*gobuild.Package{a, b}, o: tmp, goos: "linux", want: []string{filepath.Join(tmp, "a.test"), filepath.Join(tmp, "b.test")}},
+		{pkgs: []*gobuild.Package{a}, o: tmp, goos: "windows", want: []string{filepath.Join(tmp, "a.test.exe")}},
+
+		// -o names a file.
+		{pkgs: []*gobuild.Package{a}, o: out, goos: "linux", want: []string{out}},
+		{pkgs: []*gobuild.Package{a}, o: out, goos: "windows", want: []string{out}},
+		{pkgs: []*gobuild.Package{a, b}, o: out, goos: "linux", err: true},
+	}
+	for _, tt := range tests {
+		got, err := testBinaryPaths(tt.pkgs, wd, tt.o, tt.goos)
+		if tt.err {
+			if err == nil {
+				t.Errorf("testBinaryPaths(%d packages, %q, %q): expected error, got %q", len(tt.pkgs), tt.o, tt.goos, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("testBinaryPaths(%d packages, %q, %q): %v", len(tt.pkgs), tt.o, tt.goos, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("testBinaryPaths(%d packages, %q, %q): expected %q, got %q", len(tt.pkgs), tt.o, tt.goos, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package domain
+
+import (
+	_ "net/http"
+
+	"app/http/types"
+	"app/model"
+)
+
+var _ = types.Request{}
+var _ = model.User{}
@@ -0,0 +1,9 @@
+package domain
+
+import (
+	"testing"
+
+	"app/http"
+)
+
+func TestDomain(t *testing.T) { http.Serve() }
@@ -0,0 +1,11 @@
+package http
+
+import (
+	"app/http/types"
+	_ "app/model"
+	_ "github.com/x/orm"
+)
+
+var _ = types.Request{}
+
+func Serve() {}
@@ -0,0 +1,5 @@
+package model
+
+import "github.com/x/orm"
+
+type User struct{ db orm.DB }
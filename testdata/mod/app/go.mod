@@ -0,0 +1,13 @@
+// the main module of the module test project
+module example.com/app
+
+go 1.16
+
+require (
+	example.com/Upper v1.0.0
+	example.com/lib v1.0.0
+	example.com/local v0.0.0 // replaced below
+	example.com/nosum v1.0.0
+)
+
+replace example.com/local => ../local
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"example.com/app/util"
+	"example.com/lib"
+	"example.com/lib/sub"
+	"example.com/local"
+)
+
+func main() { util.Print(lib.Name + sub.Name + local.Name) }
@@ -0,0 +1,18 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+)
+
+// Print prints s, unless ctx is done.
+func Print(s string) {
+	ctx := context.Background()
+	if ctx.Err() == nil {
+		fmt.Println(s)
+	}
+}
+
+// Open opens name in fsys.
+func Open(fsys fs.FS, name string) (fs.File, error) { return fsys.Open(name) }
@@ -0,0 +1,3 @@
+#include "add.hpp"
+
+extern "C" int add(int a, int b) { return a + b; }
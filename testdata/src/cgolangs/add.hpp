@@ -0,0 +1 @@
+extern "C" int add(int, int);
@@ -0,0 +1,9 @@
+package cgolangs
+
+// #cgo CPPFLAGS: -DCGOLANGS
+// #cgo CXXFLAGS: -std=c++11
+// #cgo FFLAGS: -ffree-form
+// int add(int, int);
+import "C"
+
+func Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }
@@ -0,0 +1 @@
+void hello(void) {}
@@ -0,0 +1,9 @@
+package covercgo
+
+// int add(int a, int b) { return a + b; }
+import "C"
+
+// Add returns a+b, as computed by C.
+func Add(a, b int) int {
+	return int(C.add(C.int(a), C.int(b)))
+}
@@ -0,0 +1,6 @@
+package covercgo
+
+// Double returns twice x.
+func Double(x int) int {
+	return Add(x, x)
+}
@@ -0,0 +1,9 @@
+package covercgo
+
+import "testing"
+
+func TestDouble(t *testing.T) {
+	if got := Double(2); got != 4 {
+		t.Fatalf("Double(2): expected 4, got %d", got)
+	}
+}
@@ -0,0 +1,9 @@
+package embeddata
+
+import "embed"
+
+//go:embed hello.txt
+var hello string
+
+//go:embed static "hello.txt"
+var files embed.FS
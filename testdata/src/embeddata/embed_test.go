@@ -0,0 +1,15 @@
+package embeddata
+
+import (
+	_ "embed"
+	"testing"
+)
+
+//go:embed testdata/golden.txt
+var golden string
+
+func TestHello(t *testing.T) {
+	if hello != golden {
+		t.Fatalf("expected %q, got %q", golden, hello)
+	}
+}
@@ -0,0 +1,5 @@
+package inner
+
+import "inner/internal/secret"
+
+const S = secret.Secret
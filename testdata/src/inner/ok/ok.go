@@ -0,0 +1,5 @@
+package ok
+
+import "inner/internal/secret"
+
+const S = secret.Secret
@@ -0,0 +1,11 @@
+package internaltest
+
+import (
+	"testing"
+
+	"inner/internal/secret"
+)
+
+func TestSecret(t *testing.T) {
+	t.Log(secret.Secret)
+}
@@ -0,0 +1,5 @@
+package nocgo
+
+import "C"
+
+const Cgo = true
@@ -0,0 +1,5 @@
+// +build !cgo
+
+package nocgo
+
+const Cgo = false
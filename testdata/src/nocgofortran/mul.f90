@@ -0,0 +1,4 @@
+integer function mul(a, b)
+  integer :: a, b
+  mul = a * b
+end function mul
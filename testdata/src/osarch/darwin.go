@@ -0,0 +1,3 @@
+// +build darwin
+
+package osarch
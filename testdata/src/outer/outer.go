@@ -0,0 +1,5 @@
+package outer
+
+import "inner/internal/secret"
+
+const S = secret.Secret
@@ -0,0 +1,3 @@
+package stdinternal
+
+import _ "internal/race"
@@ -0,0 +1,2 @@
+// Package swig wraps a C library with SWIG.
+package swig
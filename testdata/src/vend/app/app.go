@@ -0,0 +1,11 @@
+package app
+
+import (
+	"a"
+	"lib"
+	"shared"
+)
+
+var _ = a.Hello
+var _ = lib.Lib
+var _ = shared.Shared